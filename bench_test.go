@@ -0,0 +1,100 @@
+package connpool_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/marlonche/connpool"
+)
+
+// A PoolItem without any resource, so that only the pool is measured.
+type benchItem struct {
+	sync.Mutex
+	pool      *connpool.Pool
+	err       error
+	container connpool.PoolItem
+}
+
+func (self *benchItem) SetContainer(container connpool.PoolItem) {
+	self.Lock()
+	defer self.Unlock()
+	self.container = container
+}
+
+func (self *benchItem) GetContainer() connpool.PoolItem {
+	self.Lock()
+	defer self.Unlock()
+	return self.container
+}
+
+func (self *benchItem) SetErr(err error) {
+	self.Lock()
+	defer self.Unlock()
+	self.err = err
+}
+
+func (self *benchItem) GetErr() error {
+	self.Lock()
+	defer self.Unlock()
+	return self.err
+}
+
+func (self *benchItem) Close() error {
+	if self.GetErr() != nil {
+		self.pool.ClearItem(self)
+	} else {
+		self.pool.GiveBack(self)
+	}
+	return nil
+}
+
+type benchCreator struct {
+	pool *connpool.Pool
+}
+
+func (self *benchCreator) NewItem() (connpool.PoolItem, error) {
+	return &benchItem{pool: self.pool}, nil
+}
+
+func (self *benchCreator) InitItem(item connpool.PoolItem, n uint64) error {
+	return nil
+}
+
+func (self *benchCreator) Close() error {
+	return nil
+}
+
+func benchmarkGetGiveBack(b *testing.B, newPool func(creator connpool.Creator) *connpool.Pool) {
+	creator := &benchCreator{}
+	pool := newPool(creator)
+	creator.pool = pool
+	defer pool.Close()
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			item, err := pool.Get()
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			item.Close()
+		}
+	})
+}
+
+// Get() and GiveBack() of the default pool, with one stack of idle items and
+// every GiveBack() taking Pool.mu.
+func BenchmarkGetGiveBack(b *testing.B) {
+	benchmarkGetGiveBack(b, func(creator connpool.Creator) *connpool.Pool {
+		return connpool.NewPool(b.Name(), creator, 256, 256, 0)
+	})
+}
+
+// Get() and GiveBack() of the sharded pool, with idle items spread over shards
+// and GiveBack() not taking Pool.mu unless Get() calls are waiting.
+func BenchmarkGetGiveBackSharded(b *testing.B) {
+	benchmarkGetGiveBack(b, func(creator connpool.Creator) *connpool.Pool {
+		return connpool.NewShardedPool(b.Name(), creator, 256, 256, 0, 0)
+	})
+}
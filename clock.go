@@ -0,0 +1,50 @@
+package connpool
+
+import (
+	"time"
+)
+
+// Source of time used by a pool for idle timeout, Get() timeout, waiting in
+// GiveBack() and retrying creation, set by Pool.SetClock().
+//
+// The default one uses package time. A fake one for tests can be found in
+// package github.com/marlonche/connpool/connpooltest.
+type Clock interface {
+	Now() time.Time
+
+	// Like time.NewTimer().
+	NewTimer(d time.Duration) Timer
+
+	// Like time.AfterFunc(), C() of the returned Timer is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer created by Clock, like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Clock of package time.
+type realClock struct{}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (self realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (self realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (self realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+func (self realTimer) C() <-chan time.Time {
+	return self.Timer.C
+}
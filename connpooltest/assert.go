@@ -0,0 +1,54 @@
+package connpooltest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+)
+
+// Maximum time for the helpers below to wait for the asynchronous work of a
+// pool, e.g., Pool.GiveBack(), to finish.
+var WaitTimeout = time.Second
+
+// Wait until cond returns true or WaitTimeout expires.
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(WaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+// Assert that no item of the pool is held by users, i.e., every item taken by
+// Pool.Get() has been given back or cleared.
+//
+// It waits up to WaitTimeout for GiveBack() and ClearItem() in flight.
+func AssertNoLeaks(t testing.TB, pool *connpool.Pool) {
+	t.Helper()
+	ok := waitFor(func() bool {
+		return pool.GetTotalNum() == pool.GetIdleNum()
+	})
+	if !ok {
+		t.Errorf("pool %v leaks items: total %v, idle %v", pool.GetName(), pool.GetTotalNum(), pool.GetIdleNum())
+	}
+}
+
+// Wait up to WaitTimeout until the pool has n idle items.
+func WaitForIdle(t testing.TB, pool *connpool.Pool, n int) {
+	t.Helper()
+	if !waitFor(func() bool { return pool.GetIdleNum() == n }) {
+		t.Fatalf("pool %v has %v idle items, want %v", pool.GetName(), pool.GetIdleNum(), n)
+	}
+}
+
+// Wait up to WaitTimeout until the pool has n items in total.
+func WaitForTotal(t testing.TB, pool *connpool.Pool, n int) {
+	t.Helper()
+	if !waitFor(func() bool { return pool.GetTotalNum() == n }) {
+		t.Fatalf("pool %v has %v items in total, want %v", pool.GetName(), pool.GetTotalNum(), n)
+	}
+}
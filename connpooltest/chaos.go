@@ -0,0 +1,256 @@
+package connpooltest
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/marlonche/connpool"
+)
+
+// Error injected by ChaosCreator.
+var ErrChaos = errors.New("connpooltest: injected fault")
+
+// Faults injected by ChaosCreator, by probability in [0, 1] or by schedule.
+// Schedules list the 1-based sequence numbers of calls which always fail.
+type ChaosConfig struct {
+	// Seed of the random source, the same seed gives the same decisions for
+	// the same sequence of calls.
+	Seed int64
+
+	NewItemErrRate float64
+	NewItemErrAt   []int
+	// NewItem() is delayed by a random duration in [0, NewItemLatency).
+	NewItemLatency time.Duration
+
+	InitItemErrRate float64
+	InitItemErrAt   []int
+
+	// After InitItem() succeeds, SetErr(ErrChaos) is called on the item with
+	// probability UseErrRate, after a random duration in [0, UseErrDelay),
+	// as if the backend broke while the item is used. The fault is skipped if
+	// the item is no longer in the same use by then, which can only be told
+	// after ChaosCreator.SetPool().
+	UseErrRate  float64
+	UseErrDelay time.Duration
+}
+
+// Numbers of faults injected by ChaosCreator.
+type ChaosFaults struct {
+	NewItemErrs  int
+	InitItemErrs int
+	UseErrs      int // use errors injected, not counting skipped ones
+}
+
+// A connpool.Creator wrapping another one and injecting faults into it
+// according to a ChaosConfig.
+//
+// It implements connpool.ContextCreator, passing the context to the wrapped
+// Creator if it is a connpool.ContextCreator too, and connpool.Resetter in the
+// same way.
+//
+//	creator := connpooltest.NewChaosCreator(realCreator, connpooltest.ChaosConfig{
+//		Seed:           1,
+//		NewItemErrRate: 0.1,
+//		NewItemLatency: 100 * time.Millisecond,
+//	})
+//	pool := connpool.NewPool("chaos", creator, 10, 5, 60)
+//	creator.SetPool(pool)
+type ChaosCreator struct {
+	creator connpool.Creator
+	config  ChaosConfig
+
+	mu      sync.Mutex
+	pool    *connpool.Pool
+	clock   connpool.Clock
+	rand    *rand.Rand
+	newNum  int
+	initNum int
+	faults  ChaosFaults
+}
+
+func NewChaosCreator(creator connpool.Creator, config ChaosConfig) *ChaosCreator {
+	return &ChaosCreator{
+		creator: creator,
+		config:  config,
+		rand:    rand.New(rand.NewPCG(uint64(config.Seed), 0)),
+	}
+}
+
+// Set the pool using the creator, so that use errors are only injected into
+// items still borrowed by the use they are scheduled for, not into items
+// which have been given back or closed meanwhile.
+func (self *ChaosCreator) SetPool(pool *connpool.Pool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.pool = pool
+}
+
+// Set the clock of the latency and use error delays, e.g. a FakeClock,
+// default the real time.
+func (self *ChaosCreator) SetClock(clock connpool.Clock) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.clock = clock
+}
+
+// Wait for d on the clock, or return the error of ctx if it is done first.
+func (self *ChaosCreator) sleep(ctx context.Context, d time.Duration) error {
+	self.mu.Lock()
+	clock := self.clock
+	self.mu.Unlock()
+	var c <-chan time.Time
+	var stop func() bool
+	if nil == clock {
+		timer := time.NewTimer(d)
+		c, stop = timer.C, timer.Stop
+	} else {
+		timer := clock.NewTimer(d)
+		c, stop = timer.C(), timer.Stop
+	}
+	select {
+	case <-ctx.Done():
+		stop()
+		return ctx.Err()
+	case <-c:
+		return nil
+	}
+}
+
+func (self *ChaosCreator) afterFunc(d time.Duration, f func()) {
+	self.mu.Lock()
+	clock := self.clock
+	self.mu.Unlock()
+	if nil == clock {
+		time.AfterFunc(d, f)
+		return
+	}
+	clock.AfterFunc(d, f)
+}
+
+// Whether item is still borrowed by use n, always true without SetPool().
+func (self *ChaosCreator) inUse(item connpool.PoolItem, n uint64) bool {
+	self.mu.Lock()
+	pool := self.pool
+	self.mu.Unlock()
+	if nil == pool {
+		return true
+	}
+	info, ok := pool.ItemInfo(item)
+	return ok && info.State == connpool.StateBorrowed && info.UseCount == n
+}
+
+func scheduled(at []int, n int) bool {
+	for _, i := range at {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Must be called with self.mu held.
+func (self *ChaosCreator) hit(rate float64) bool {
+	return rate > 0 && self.rand.Float64() < rate
+}
+
+// Must be called with self.mu held.
+func (self *ChaosCreator) randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(self.rand.Int64N(int64(max)))
+}
+
+func (self *ChaosCreator) NewItem() (connpool.PoolItem, error) {
+	return self.NewItemContext(context.Background())
+}
+
+func (self *ChaosCreator) InitItem(item connpool.PoolItem, n uint64) error {
+	return self.InitItemContext(context.Background(), item, n)
+}
+
+func (self *ChaosCreator) NewItemContext(ctx context.Context) (connpool.PoolItem, error) {
+	self.mu.Lock()
+	self.newNum++
+	fail := scheduled(self.config.NewItemErrAt, self.newNum) || self.hit(self.config.NewItemErrRate)
+	if fail {
+		self.faults.NewItemErrs++
+	}
+	latency := self.randDuration(self.config.NewItemLatency)
+	self.mu.Unlock()
+
+	if latency > 0 {
+		if err := self.sleep(ctx, latency); err != nil {
+			return nil, err
+		}
+	}
+	if fail {
+		return nil, ErrChaos
+	}
+	if c, ok := self.creator.(connpool.ContextCreator); ok {
+		return c.NewItemContext(ctx)
+	}
+	return self.creator.NewItem()
+}
+
+func (self *ChaosCreator) InitItemContext(ctx context.Context, item connpool.PoolItem, n uint64) error {
+	self.mu.Lock()
+	self.initNum++
+	fail := scheduled(self.config.InitItemErrAt, self.initNum) || self.hit(self.config.InitItemErrRate)
+	if fail {
+		self.faults.InitItemErrs++
+	}
+	self.mu.Unlock()
+
+	if fail {
+		return ErrChaos
+	}
+	var err error
+	if c, ok := self.creator.(connpool.ContextCreator); ok {
+		err = c.InitItemContext(ctx, item, n)
+	} else {
+		err = self.creator.InitItem(item, n)
+	}
+	if err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	useErr := self.hit(self.config.UseErrRate)
+	delay := self.randDuration(self.config.UseErrDelay)
+	self.mu.Unlock()
+	if useErr {
+		self.afterFunc(delay, func() {
+			// the item can still be given back before SetErr(), rarely
+			if !self.inUse(item, n) {
+				return
+			}
+			self.mu.Lock()
+			self.faults.UseErrs++
+			self.mu.Unlock()
+			item.SetErr(ErrChaos)
+		})
+	}
+	return nil
+}
+
+func (self *ChaosCreator) ResetItem(item connpool.PoolItem) error {
+	if r, ok := self.creator.(connpool.Resetter); ok {
+		return r.ResetItem(item)
+	}
+	return nil
+}
+
+func (self *ChaosCreator) Close() error {
+	return self.creator.Close()
+}
+
+// Get the numbers of faults injected so far.
+func (self *ChaosCreator) Faults() ChaosFaults {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.faults
+}
@@ -0,0 +1,164 @@
+// Package connpooltest provides utilities for testing code using package
+// github.com/marlonche/connpool.
+package connpooltest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marlonche/connpool"
+)
+
+// A connpool.Clock whose time only moves by Advance(), so that timeouts of a
+// pool can be tested without waiting.
+//
+//	clock := connpooltest.NewFakeClock(time.Now())
+//	pool.SetClock(clock)
+//	...
+//	clock.Advance(time.Minute) // idle items expire
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	c      chan time.Time
+	f      func()
+	when   time.Time
+	active bool
+}
+
+// Create a FakeClock starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	clock := &FakeClock{now: now}
+	clock.cond = sync.NewCond(&clock.mu)
+	return clock
+}
+
+func (self *FakeClock) Now() time.Time {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.now
+}
+
+func (self *FakeClock) NewTimer(d time.Duration) connpool.Timer {
+	timer := &fakeTimer{
+		clock: self,
+		c:     make(chan time.Time, 1),
+	}
+	timer.Reset(d)
+	return timer
+}
+
+func (self *FakeClock) AfterFunc(d time.Duration, f func()) connpool.Timer {
+	timer := &fakeTimer{
+		clock: self,
+		f:     f,
+	}
+	timer.Reset(d)
+	return timer
+}
+
+// Move the time forward by d, firing timers due by then in order of their
+// due time. Functions of AfterFunc() are run in their own goroutines.
+func (self *FakeClock) Advance(d time.Duration) {
+	self.mu.Lock()
+	self.now = self.now.Add(d)
+	now := self.now
+	var fired []*fakeTimer
+	pending := self.timers[:0]
+	for _, timer := range self.timers {
+		if timer.when.After(now) {
+			pending = append(pending, timer)
+		} else {
+			timer.active = false
+			fired = append(fired, timer)
+		}
+	}
+	self.timers = pending
+	self.cond.Broadcast()
+	self.mu.Unlock()
+
+	sort.SliceStable(fired, func(i, j int) bool {
+		return fired[i].when.Before(fired[j].when)
+	})
+	for _, timer := range fired {
+		timer.fire(now)
+	}
+}
+
+// Get the number of timers not fired or stopped yet.
+func (self *FakeClock) TimerNum() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return len(self.timers)
+}
+
+// Block until at least n timers are pending, e.g., until a Get() starts
+// waiting with its timeout, so that Advance() is not called too early.
+func (self *FakeClock) BlockUntil(n int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for len(self.timers) < n {
+		self.cond.Wait()
+	}
+}
+
+func (self *fakeTimer) C() <-chan time.Time {
+	return self.c
+}
+
+func (self *fakeTimer) Stop() bool {
+	clock := self.clock
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return self.stopLocked()
+}
+
+func (self *fakeTimer) stopLocked() bool {
+	if !self.active {
+		return false
+	}
+	self.active = false
+	for i, timer := range self.clock.timers {
+		if timer == self {
+			self.clock.timers = append(self.clock.timers[:i], self.clock.timers[i+1:]...)
+			break
+		}
+	}
+	self.clock.cond.Broadcast()
+	return true
+}
+
+func (self *fakeTimer) Reset(d time.Duration) bool {
+	clock := self.clock
+	clock.mu.Lock()
+	active := self.stopLocked()
+	self.when = clock.now.Add(d)
+	if d <= 0 {
+		now := clock.now
+		clock.mu.Unlock()
+		self.fire(now)
+		return active
+	}
+	self.active = true
+	clock.timers = append(clock.timers, self)
+	clock.cond.Broadcast()
+	clock.mu.Unlock()
+	return active
+}
+
+func (self *fakeTimer) fire(now time.Time) {
+	if self.f != nil {
+		go self.f()
+		return
+	}
+	select {
+	case self.c <- now:
+	default:
+	}
+}
@@ -0,0 +1,264 @@
+package connpooltest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+var errFake = errors.New("fake")
+
+// A testing.TB recording failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (self *recorder) Errorf(format string, args ...any) {
+	self.failures = append(self.failures, fmt.Sprintf(format, args...))
+}
+
+func (self *recorder) Fatalf(format string, args ...any) {
+	self.Errorf(format, args...)
+}
+
+func TestFakeCreator(t *testing.T) {
+	creator := connpooltest.NewFakeCreator()
+	creator.FailNewItem(errFake, nil)
+	creator.FailInitItem(errFake)
+	creator.FailResetItem(errFake)
+	if _, err := creator.NewItem(); err != errFake {
+		t.Fatalf("1st NewItem: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := creator.NewItem(); err != nil {
+			t.Fatalf("NewItem: %v", err)
+		}
+	}
+	items := creator.Items()
+	if len(items) != 2 || items[0].ID() != 1 || items[1].ID() != 2 {
+		t.Fatalf("items %v", items)
+	}
+	if err := creator.InitItem(items[0], 1); err != errFake {
+		t.Fatalf("1st InitItem: %v", err)
+	}
+	if err := creator.InitItem(items[0], 1); err != nil {
+		t.Fatalf("InitItem: %v", err)
+	}
+	if err := creator.ResetItem(items[0]); err != errFake {
+		t.Fatalf("1st ResetItem: %v", err)
+	}
+	creator.Close()
+	if creator.NewItemNum() != 3 || creator.InitItemNum() != 2 || creator.ResetItemNum() != 1 || !creator.Closed() {
+		t.Fatal("calls not counted")
+	}
+}
+
+func TestFakeCreatorLatency(t *testing.T) {
+	creator := connpooltest.NewFakeCreator()
+	creator.SetNewItemLatency(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := creator.NewItemContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("NewItemContext: %v", err)
+	}
+	if len(creator.Items()) != 0 {
+		t.Fatal("item created after the context is done")
+	}
+}
+
+func TestFakeItem(t *testing.T) {
+	creator := connpooltest.NewFakeCreator()
+	pool := connpool.NewPool("TestFakeItem", creator, 2, 2, 0)
+	defer pool.Close()
+	creator.SetPool(pool, true)
+
+	pooled, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	item := pooled.(*connpooltest.FakeItem)
+	if item.GetContainer() == nil {
+		t.Fatal("container not set")
+	}
+	if err := item.Close(); err != nil || item.Closed() {
+		t.Fatalf("Close without error: %v, closed %v", err, item.Closed())
+	}
+	if _, err := pool.Get(); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	item.SetErr(nil)
+	item.SetErr(errFake)
+	if err := item.Close(); err != nil || !item.Closed() {
+		t.Fatalf("Close with error: %v, closed %v", err, item.Closed())
+	}
+	if err := item.Close(); err != connpooltest.ErrItemClosed {
+		t.Fatalf("Close after closed: %v", err)
+	}
+	if calls := item.SetErrCalls(); len(calls) != 2 || calls[0] != nil || calls[1] != errFake {
+		t.Fatalf("SetErr calls %v", calls)
+	}
+	if n := item.CloseNum(); n != 3 {
+		t.Fatalf("Close called %v times, want 3", n)
+	}
+	if _, ok := pool.ItemInfo(item); ok {
+		t.Fatal("item with error not cleared")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Now()
+	clock := connpooltest.NewFakeClock(start)
+	timer := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(time.Second)
+	fired := make(chan struct{})
+	clock.AfterFunc(2*time.Second, func() { close(fired) })
+	clock.BlockUntil(3)
+	if !stopped.Stop() || clock.TimerNum() != 2 {
+		t.Fatalf("Stop, %v timers pending", clock.TimerNum())
+	}
+
+	clock.Advance(time.Second)
+	if now := clock.Now(); !now.Equal(start.Add(time.Second)) {
+		t.Fatalf("Now %v after Advance", now)
+	}
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("timer not fired")
+	}
+	select {
+	case <-stopped.C():
+		t.Fatal("stopped timer fired")
+	case <-fired:
+		t.Fatal("AfterFunc run early")
+	default:
+	}
+	if timer.Stop() {
+		t.Fatal("Stop of a fired timer returns true")
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-fired:
+	case <-time.After(connpooltest.WaitTimeout):
+		t.Fatal("AfterFunc not run")
+	}
+	if n := clock.TimerNum(); n != 0 {
+		t.Fatalf("%v timers pending", n)
+	}
+}
+
+func TestAssertNoLeaks(t *testing.T) {
+	creator := connpooltest.NewFakeCreator()
+	pool := connpool.NewPool("TestAssertNoLeaks", creator, 2, 2, 0)
+	defer pool.Close()
+	creator.SetPool(pool, false)
+	item, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	defer func(d time.Duration) { connpooltest.WaitTimeout = d }(connpooltest.WaitTimeout)
+	connpooltest.WaitTimeout = 50 * time.Millisecond
+	rec := &recorder{TB: t}
+	connpooltest.AssertNoLeaks(rec, pool)
+	if len(rec.failures) != 1 {
+		t.Fatalf("borrowed item not reported: %v", rec.failures)
+	}
+	item.Close()
+	rec = &recorder{TB: t}
+	connpooltest.AssertNoLeaks(rec, pool)
+	connpooltest.WaitForIdle(rec, pool, pool.GetTotalNum())
+	connpooltest.WaitForTotal(rec, pool, pool.GetTotalNum())
+	if len(rec.failures) != 0 {
+		t.Fatalf("failures after given back: %v", rec.failures)
+	}
+	connpooltest.WaitForTotal(rec, pool, 10)
+	if len(rec.failures) != 1 {
+		t.Fatalf("WaitForTotal not failed: %v", rec.failures)
+	}
+}
+
+func TestChaosCreatorSeed(t *testing.T) {
+	config := connpooltest.ChaosConfig{
+		Seed:            7,
+		NewItemErrRate:  0.3,
+		NewItemErrAt:    []int{2},
+		InitItemErrRate: 0.3,
+	}
+	run := func() (string, connpooltest.ChaosFaults) {
+		creator := connpooltest.NewChaosCreator(connpooltest.NewFakeCreator(), config)
+		var results []byte
+		for i := 0; i < 50; i++ {
+			item, err := creator.NewItem()
+			switch {
+			case err != nil:
+				results = append(results, 'n')
+			case creator.InitItem(item, 1) != nil:
+				results = append(results, 'i')
+			default:
+				results = append(results, '.')
+			}
+		}
+		return string(results), creator.Faults()
+	}
+	results, faults := run()
+	if results[1] != 'n' {
+		t.Fatalf("scheduled fault not injected: %v", results)
+	}
+	if faults.NewItemErrs == 0 || faults.InitItemErrs == 0 {
+		t.Fatalf("faults %+v", faults)
+	}
+	if again, _ := run(); again != results {
+		t.Fatalf("same seed gives %v then %v", results, again)
+	}
+}
+
+func TestChaosCreatorUseErr(t *testing.T) {
+	fake := connpooltest.NewFakeCreator()
+	creator := connpooltest.NewChaosCreator(fake, connpooltest.ChaosConfig{
+		Seed:        1,
+		UseErrRate:  1,
+		UseErrDelay: time.Second,
+	})
+	pool := connpool.NewPool("TestChaosCreatorUseErr", creator, 1, 1, 0)
+	defer pool.Close()
+	fake.SetPool(pool, true)
+	creator.SetPool(pool)
+	clock := connpooltest.NewFakeClock(time.Now())
+	creator.SetClock(clock)
+
+	// given back before the fault, which is skipped
+	item, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	item.Close()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	// still used when the fault lands
+	if again, err := pool.Get(); err != nil || again != item {
+		t.Fatalf("Get: %v", err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	for deadline := time.Now().Add(connpooltest.WaitTimeout); item.GetErr() == nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("use error not injected")
+		}
+	}
+	if err := item.GetErr(); err != connpooltest.ErrChaos {
+		t.Fatalf("used item got error %v", err)
+	}
+	item.Close()
+	if n := creator.Faults().UseErrs; n != 1 {
+		t.Fatalf("%v use errors injected, want 1", n)
+	}
+}
@@ -0,0 +1,292 @@
+package connpooltest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/marlonche/connpool"
+)
+
+var ErrItemClosed = errors.New("fake item already closed")
+
+// A connpool.PoolItem for tests, recording calls of SetErr() and Close().
+//
+// Close() gives the item back to the pool, or clears it from the pool if an
+// error is set, as required by connpool.PoolItem.
+type FakeItem struct {
+	mu        sync.Mutex
+	creator   *FakeCreator
+	id        int
+	err       error
+	container connpool.PoolItem
+	closed    bool
+	errs      []error
+	closeNum  int
+}
+
+func (self *FakeItem) SetContainer(container connpool.PoolItem) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.container = container
+}
+
+func (self *FakeItem) GetContainer() connpool.PoolItem {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.container
+}
+
+func (self *FakeItem) SetErr(err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.errs = append(self.errs, err)
+	if err != nil && !self.closed {
+		self.err = err
+	}
+}
+
+func (self *FakeItem) GetErr() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.err
+}
+
+func (self *FakeItem) Close() error {
+	self.mu.Lock()
+	self.closeNum++
+	if self.closed {
+		self.mu.Unlock()
+		return ErrItemClosed
+	}
+	err := self.err
+	if err != nil {
+		self.closed = true
+	}
+	self.mu.Unlock()
+
+	pool, syncReturn := self.creator.getPool()
+	switch {
+	case nil == pool:
+		// not created for a pool, e.g., discarded by connpool.WithCreateTimeout()
+	case err != nil && syncReturn:
+		return pool.ClearItemSync(self)
+	case err != nil:
+		pool.ClearItem(self)
+	case syncReturn:
+		return pool.GiveBackSync(self)
+	default:
+		pool.GiveBack(self)
+	}
+	return nil
+}
+
+// Get the sequence number of the item, starting from 1 for the first item
+// created by its FakeCreator.
+func (self *FakeItem) ID() int {
+	return self.id
+}
+
+// Get the errors passed to SetErr() so far, in order.
+func (self *FakeItem) SetErrCalls() []error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return append([]error(nil), self.errs...)
+}
+
+// Get how many times Close() is called.
+func (self *FakeItem) CloseNum() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.closeNum
+}
+
+// Whether the item is closed for good, i.e., Close() is called with an error set.
+func (self *FakeItem) Closed() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.closed
+}
+
+// A connpool.Creator for tests creating FakeItems, whose failures and latency
+// can be scripted. It implements connpool.ContextCreator and connpool.Resetter,
+// and a NewItem() waiting for its latency returns early when the context is
+// done.
+//
+//	creator := connpooltest.NewFakeCreator()
+//	pool := connpool.NewPool("test", creator, 10, 5, 0)
+//	creator.SetPool(pool, true)
+//	creator.FailNewItem(errDial, nil, errDial) // 1st and 3rd NewItem() fail
+type FakeCreator struct {
+	mu         sync.Mutex
+	pool       *connpool.Pool
+	syncReturn bool
+	newErrs    []error
+	initErrs   []error
+	resetErrs  []error
+	newLatency time.Duration
+	items      []*FakeItem
+	newNum     int
+	initNum    int
+	resetNum   int
+	closed     bool
+}
+
+func NewFakeCreator() *FakeCreator {
+	return &FakeCreator{}
+}
+
+// Set the pool which FakeItems are returned to, it should be called right
+// after connpool.NewPool().
+//
+// If syncReturn is true, FakeItem.Close() uses Pool.GiveBackSync() and
+// Pool.ClearItemSync(), otherwise Pool.GiveBack() and Pool.ClearItem().
+func (self *FakeCreator) SetPool(pool *connpool.Pool, syncReturn bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.pool = pool
+	self.syncReturn = syncReturn
+}
+
+func (self *FakeCreator) getPool() (*connpool.Pool, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.pool, self.syncReturn
+}
+
+// Script the results of the next NewItem() calls, one error per call,
+// nil means success. Calls beyond the script succeed.
+func (self *FakeCreator) FailNewItem(errs ...error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.newErrs = append(self.newErrs, errs...)
+}
+
+// Script the results of the next InitItem() calls, like FailNewItem().
+func (self *FakeCreator) FailInitItem(errs ...error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.initErrs = append(self.initErrs, errs...)
+}
+
+// Script the results of the next ResetItem() calls, like FailNewItem().
+func (self *FakeCreator) FailResetItem(errs ...error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.resetErrs = append(self.resetErrs, errs...)
+}
+
+// Make every NewItem() take d before returning.
+func (self *FakeCreator) SetNewItemLatency(d time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.newLatency = d
+}
+
+func (self *FakeCreator) NewItem() (connpool.PoolItem, error) {
+	return self.NewItemContext(context.Background())
+}
+
+func (self *FakeCreator) InitItem(item connpool.PoolItem, n uint64) error {
+	return self.InitItemContext(context.Background(), item, n)
+}
+
+func (self *FakeCreator) NewItemContext(ctx context.Context) (connpool.PoolItem, error) {
+	self.mu.Lock()
+	self.newNum++
+	latency := self.newLatency
+	var err error
+	if len(self.newErrs) > 0 {
+		err = self.newErrs[0]
+		self.newErrs = self.newErrs[1:]
+	}
+	self.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	item := &FakeItem{
+		creator: self,
+		id:      len(self.items) + 1,
+	}
+	self.items = append(self.items, item)
+	return item, nil
+}
+
+func (self *FakeCreator) InitItemContext(ctx context.Context, item connpool.PoolItem, n uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.initNum++
+	if len(self.initErrs) > 0 {
+		err := self.initErrs[0]
+		self.initErrs = self.initErrs[1:]
+		return err
+	}
+	return nil
+}
+
+func (self *FakeCreator) ResetItem(item connpool.PoolItem) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.resetNum++
+	if len(self.resetErrs) > 0 {
+		err := self.resetErrs[0]
+		self.resetErrs = self.resetErrs[1:]
+		return err
+	}
+	return nil
+}
+
+func (self *FakeCreator) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.closed = true
+	return nil
+}
+
+// Get all items created so far, in order of creation.
+func (self *FakeCreator) Items() []*FakeItem {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return append([]*FakeItem(nil), self.items...)
+}
+
+// Get how many times NewItem() is called, including failed calls.
+func (self *FakeCreator) NewItemNum() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.newNum
+}
+
+// Get how many times InitItem() is called, including failed calls.
+func (self *FakeCreator) InitItemNum() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.initNum
+}
+
+// Get how many times ResetItem() is called, including failed calls.
+func (self *FakeCreator) ResetItemNum() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.resetNum
+}
+
+// Whether Close() is called.
+func (self *FakeCreator) Closed() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.closed
+}
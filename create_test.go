@@ -0,0 +1,197 @@
+package connpool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+// A FakeCreator recording why the contexts of failed NewItemContext() calls
+// are done.
+type causeCreator struct {
+	*connpooltest.FakeCreator
+	mu     sync.Mutex
+	causes []error
+}
+
+func (self *causeCreator) NewItemContext(ctx context.Context) (connpool.PoolItem, error) {
+	item, err := self.FakeCreator.NewItemContext(ctx)
+	if err != nil {
+		self.mu.Lock()
+		self.causes = append(self.causes, context.Cause(ctx))
+		self.mu.Unlock()
+	}
+	return item, err
+}
+
+func (self *causeCreator) getCauses() []error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return append([]error(nil), self.causes...)
+}
+
+func TestCreateTimeout(t *testing.T) {
+	creator := &causeCreator{FakeCreator: connpooltest.NewFakeCreator()}
+	creator.SetNewItemLatency(time.Hour)
+	pool := connpool.NewPool(t.Name(), creator, 1, 1, 0)
+	defer pool.Close()
+	creator.SetPool(pool, true)
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	pool.SetCreateTimeout(time.Second)
+
+	errc := make(chan error, 1)
+	go func() {
+		item, err := pool.Get()
+		if err == nil {
+			item.Close()
+		}
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	waitFor(t, func() bool { return pool.Stats().CreateFailedNum == 1 })
+	if causes := creator.getCauses(); len(causes) != 1 || causes[0] != connpool.ErrCreateTimeout {
+		t.Fatalf("creation cancelled by %v", causes)
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("Get returned %v after the creation timed out", err)
+	default:
+	}
+
+	// the creation is retried for the waiting Get()
+	creator.SetNewItemLatency(0)
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
+	if err := <-errc; err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+}
+
+func TestCreateCancelledOnClose(t *testing.T) {
+	creator := &causeCreator{FakeCreator: connpooltest.NewFakeCreator()}
+	creator.SetNewItemLatency(time.Hour)
+	pool := connpool.NewPool(t.Name(), creator, 1, 1, 0)
+	creator.SetPool(pool, true)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := pool.Get()
+		errc <- err
+	}()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 1 && creator.NewItemNum() == 1 })
+	pool.Close()
+	if err := <-errc; !errors.Is(err, connpool.ErrPoolClosed) {
+		t.Fatalf("Get: %v", err)
+	}
+	connpooltest.WaitForTotal(t, pool, 0)
+	if causes := creator.getCauses(); len(causes) != 1 || causes[0] != context.Canceled {
+		t.Fatalf("creation cancelled by %v", causes)
+	}
+	if len(creator.Items()) != 0 {
+		t.Fatal("item created after the pool is closed")
+	}
+}
+
+// A FakeCreator whose NewItemContext() calls wait for release().
+type gateCreator struct {
+	*connpooltest.FakeCreator
+	gate chan struct{}
+}
+
+func newGateCreator() *gateCreator {
+	return &gateCreator{FakeCreator: connpooltest.NewFakeCreator(), gate: make(chan struct{})}
+}
+
+func (self *gateCreator) NewItemContext(ctx context.Context) (connpool.PoolItem, error) {
+	select {
+	case <-self.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return self.FakeCreator.NewItemContext(ctx)
+}
+
+func (self *gateCreator) release() {
+	self.gate <- struct{}{}
+}
+
+// Start n Get() calls sending their items to the returned channel.
+func getAsync(t *testing.T, pool *connpool.Pool, n int) chan connpool.PoolItem {
+	items := make(chan connpool.PoolItem, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			item, err := pool.Get()
+			if err != nil {
+				t.Errorf("Get: %v", err)
+			}
+			items <- item
+		}()
+	}
+	return items
+}
+
+func TestMaxConnecting(t *testing.T) {
+	creator := newGateCreator()
+	pool := connpool.NewPool(t.Name(), creator, 10, 10, 0)
+	defer pool.Close()
+	creator.SetPool(pool, true)
+	pool.SetMaxConnecting(2)
+
+	items := getAsync(t, pool, 5)
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 5 })
+	if n := pool.Stats().CreatingNum; n != 2 {
+		t.Fatalf("%v items being created, want 2", n)
+	}
+	// the next creation starts when one finishes
+	creator.release()
+	(<-items).Close()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 3 })
+	if n := pool.Stats().CreatingNum; n != 2 {
+		t.Fatalf("%v items being created, want 2", n)
+	}
+
+	// removing the limit starts creations for all waiting Get() calls
+	pool.SetMaxConnecting(0)
+	if n := pool.Stats().CreatingNum; n != 3 {
+		t.Fatalf("%v items being created after the limit is removed, want 3", n)
+	}
+	for i := 0; i < 3; i++ {
+		creator.release()
+	}
+	for i := 0; i < 4; i++ {
+		(<-items).Close()
+	}
+}
+
+func TestCreateRate(t *testing.T) {
+	pool, creator := newTestPool(t, 10, 10)
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	pool.SetCreateRate(1, 2)
+
+	items := getAsync(t, pool, 5)
+	// a burst of 2 is created at once
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 3 && len(items) == 2 })
+	if stats := pool.Stats(); stats.CreatingNum != 0 || creator.NewItemNum() != 2 {
+		t.Fatalf("%v items being created beyond the burst", stats.CreatingNum)
+	}
+	// then one per second
+	for waiters := 2; waiters >= 0; waiters-- {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		waitFor(t, func() bool { return pool.Stats().WaiterNum == waiters })
+		if n := creator.NewItemNum(); n != 5-waiters {
+			t.Fatalf("%v items created after %v seconds", n, 3-waiters)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		(<-items).Close()
+	}
+}
@@ -0,0 +1,175 @@
+package connpool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// State of a pool shown by DebugHandler().
+type debugPool struct {
+	Config Config
+	Stats  Stats
+	Items  []debugItem
+}
+
+// ItemInfo without the item itself, which may not be serializable.
+type debugItem struct {
+	ID           uint64
+	Generation   uint64
+	State        ItemState
+	CreatedAt    time.Time
+	LastBorrowed time.Time
+	LastReturned time.Time
+	UseCount     uint64
+	LastErr      string
+}
+
+func newDebugPool(pool *Pool) debugPool {
+	infos := pool.Snapshot()
+	items := make([]debugItem, len(infos))
+	for i, info := range infos {
+		items[i] = debugItem{
+			ID:           info.ID,
+			Generation:   info.Generation,
+			State:        info.State,
+			CreatedAt:    info.CreatedAt,
+			LastBorrowed: info.LastBorrowed,
+			LastReturned: info.LastReturned,
+			UseCount:     info.UseCount,
+		}
+		if info.LastErr != nil {
+			items[i].LastErr = info.LastErr.Error()
+		}
+	}
+	return debugPool{
+		Config: pool.Config(),
+		Stats:  pool.Stats(),
+		Items:  items,
+	}
+}
+
+var debugTemplate = template.Must(template.New("connpool").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05.000")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>connpool</title>
+<style>
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+</style>
+</head>
+<body>
+{{if not .}}<p>No pool is registered, see Pool.Register().</p>{{end}}
+{{range .}}
+<h2>{{.Config.Name}}</h2>
+<table>
+<tr><th>MaxTotalNum</th><td>{{.Config.MaxTotalNum}}</td></tr>
+<tr><th>MaxIdleNum</th><td>{{.Config.MaxIdleNum}}</td></tr>
+<tr><th>IdleTimeout</th><td>{{.Config.IdleTimeout}}s</td></tr>
+<tr><th>ShardNum</th><td>{{.Config.ShardNum}}</td></tr>
+<tr><th>GetTimeout</th><td>{{.Config.GetTimeout}}s</td></tr>
+<tr><th>IdleFullPolicy</th><td>{{.Config.IdleFullPolicy}} {{.Config.IdleFullWait}}</td></tr>
+<tr><th>CreateTimeout</th><td>{{.Config.CreateTimeout}}</td></tr>
+<tr><th>MaxConnecting</th><td>{{.Config.MaxConnecting}}</td></tr>
+<tr><th>CreateRate</th><td>{{.Config.CreateRate}}/s, burst {{.Config.CreateBurst}}</td></tr>
+<tr><th>MaxWaiters</th><td>{{.Config.MaxWaiters}}</td></tr>
+<tr><th>MaxUses</th><td>{{.Config.MaxUses}}</td></tr>
+<tr><th>PauseWait</th><td>{{.Config.PauseWait}}</td></tr>
+<tr><th>EvictInterval</th><td>{{.Config.EvictInterval}}</td></tr>
+<tr><th>EvictScanNum</th><td>{{.Config.EvictScanNum}}</td></tr>
+<tr><th>MinIdle</th><td>{{.Config.MinIdle}}</td></tr>
+</table>
+<table>
+<tr><th>TotalNum</th><td>{{.Stats.TotalNum}}</td></tr>
+<tr><th>IdleNum</th><td>{{.Stats.IdleNum}}</td></tr>
+<tr><th>CreatingNum</th><td>{{.Stats.CreatingNum}}</td></tr>
+<tr><th>WaiterNum</th><td>{{.Stats.WaiterNum}}</td></tr>
+<tr><th>Paused</th><td>{{.Stats.Paused}} {{.Stats.PauseReason}}</td></tr>
+<tr><th>Generation</th><td>{{.Stats.Generation}}</td></tr>
+<tr><th>WaitNum</th><td>{{.Stats.WaitNum}}</td></tr>
+<tr><th>WaitDuration</th><td>{{.Stats.WaitDuration}}</td></tr>
+<tr><th>TooManyWaitersNum</th><td>{{.Stats.TooManyWaitersNum}}</td></tr>
+<tr><th>CreatedNum</th><td>{{.Stats.CreatedNum}}</td></tr>
+<tr><th>CreateFailedNum</th><td>{{.Stats.CreateFailedNum}}</td></tr>
+<tr><th>ClosedNum</th><td>{{.Stats.ClosedNum}}</td></tr>
+<tr><th>IdleTimeoutClosedNum</th><td>{{.Stats.IdleTimeoutClosedNum}}</td></tr>
+<tr><th>PoolClosedNum</th><td>{{.Stats.PoolClosedNum}}</td></tr>
+<tr><th>InvalidatedNum</th><td>{{.Stats.InvalidatedNum}}</td></tr>
+<tr><th>EvictedNum</th><td>{{.Stats.EvictedNum}}</td></tr>
+<tr><th>InitFailedNum</th><td>{{.Stats.InitFailedNum}}</td></tr>
+<tr><th>ResetFailedNum</th><td>{{.Stats.ResetFailedNum}}</td></tr>
+<tr><th>ClearedNum</th><td>{{.Stats.ClearedNum}}</td></tr>
+<tr><th>MaxUsesClosedNum</th><td>{{.Stats.MaxUsesClosedNum}}</td></tr>
+<tr><th>IdleFullNum</th><td>{{.Stats.IdleFullNum}}</td></tr>
+<tr><th>IdleFullWaitedNum</th><td>{{.Stats.IdleFullWaitedNum}}</td></tr>
+<tr><th>IdleFullEvictedNum</th><td>{{.Stats.IdleFullEvictedNum}}</td></tr>
+<tr><th>IdleFullClosedNum</th><td>{{.Stats.IdleFullClosedNum}}</td></tr>
+<tr><th>EvictRunNum</th><td>{{.Stats.EvictRunNum}}</td></tr>
+<tr><th>EvictRunDuration</th><td>{{.Stats.EvictRunDuration}}</td></tr>
+<tr><th>EvictRunClosedNum</th><td>{{.Stats.EvictRunClosedNum}}</td></tr>
+</table>
+<table>
+<tr><th>ID</th><th>Generation</th><th>State</th><th>CreatedAt</th><th>LastBorrowed</th><th>LastReturned</th><th>UseCount</th><th>LastErr</th></tr>
+{{range .Items}}<tr><td>{{.ID}}</td><td>{{.Generation}}</td><td>{{.State}}</td><td>{{time .CreatedAt}}</td><td>{{time .LastBorrowed}}</td><td>{{time .LastReturned}}</td><td>{{.UseCount}}</td><td>{{.LastErr}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// Get an http.Handler showing configuration, statistics and items of all
+// pools registered by Pool.Register(), mountable like net/http/pprof:
+//
+//	http.Handle("/debug/connpool/", connpool.DebugHandler())
+//
+// It renders HTML by default, and JSON if the query has format=json or the
+// request accepts application/json. Query name=xxx shows only pool xxx.
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(serveDebug)
+}
+
+func serveDebug(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("name")
+	pools := []debugPool{}
+	for _, pool := range Pools() {
+		if name != "" && pool.GetName() != name {
+			continue
+		}
+		pools = append(pools, newDebugPool(pool))
+	}
+	if name != "" && 0 == len(pools) {
+		http.Error(w, "pool not found: "+name, http.StatusNotFound)
+		return
+	}
+
+	// render into a buffer first, so that an error can still be reported
+	var buf bytes.Buffer
+	var err error
+	if query.Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(pools)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = debugTemplate.Execute(&buf, pools)
+	}
+	if err != nil {
+		fmt.Printf("DebugHandler error:%v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,100 @@
+package connpool_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+func serveDebug(t *testing.T, url string, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", url, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	connpool.DebugHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+// The part of the JSON output checked below.
+type debugJSON []struct {
+	Config struct{ Name string }
+	Stats  struct{ TotalNum int }
+	Items  []struct {
+		ID       uint64
+		State    string
+		UseCount uint64
+	}
+}
+
+func decodeDebug(t *testing.T, rec *httptest.ResponseRecorder) map[string]int {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("status %v, content type %v", rec.Code, ct)
+	}
+	var pools debugJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &pools); err != nil {
+		t.Fatalf("decode %v: %v", rec.Body.String(), err)
+	}
+	borrowed := make(map[string]int)
+	for _, pool := range pools {
+		borrowed[pool.Config.Name] = 0
+		for _, item := range pool.Items {
+			if item.State == "borrowed" && item.UseCount == 1 {
+				borrowed[pool.Config.Name]++
+			}
+		}
+	}
+	return borrowed
+}
+
+func TestDebugHandler(t *testing.T) {
+	a, _ := newTestPool(t, 2, 2)
+	b := connpool.NewPool(t.Name()+"-b", connpooltest.NewFakeCreator(), 2, 2, 0)
+	defer b.Close()
+	for _, pool := range []*connpool.Pool{a, b} {
+		if err := pool.Register(); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	item := mustGet(t, a)
+	defer item.Close()
+
+	rec := serveDebug(t, "/debug/connpool/", "")
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("status %v, content type %v", rec.Code, ct)
+	}
+	for _, pool := range []*connpool.Pool{a, b} {
+		if html := rec.Body.String(); !strings.Contains(html, "<h2>"+pool.GetName()+"</h2>") {
+			t.Fatalf("pool %v not shown in %v", pool.GetName(), html)
+		}
+	}
+
+	for _, rec := range []*httptest.ResponseRecorder{
+		serveDebug(t, "/debug/connpool/?format=json", ""),
+		serveDebug(t, "/debug/connpool/", "application/json"),
+	} {
+		borrowed := decodeDebug(t, rec)
+		if n, ok := borrowed[a.GetName()]; !ok || n != 1 {
+			t.Fatalf("pool %v has %v borrowed items in %v", a.GetName(), n, rec.Body.String())
+		}
+		if _, ok := borrowed[b.GetName()]; !ok {
+			t.Fatalf("pool %v not shown in %v", b.GetName(), rec.Body.String())
+		}
+	}
+
+	rec = serveDebug(t, "/debug/connpool/?format=json&name="+b.GetName(), "")
+	if borrowed := decodeDebug(t, rec); len(borrowed) != 1 {
+		t.Fatalf("pools other than %v shown in %v", b.GetName(), rec.Body.String())
+	}
+
+	if rec = serveDebug(t, "/debug/connpool/?name=nonexistent", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("status %v for an unknown pool", rec.Code)
+	}
+}
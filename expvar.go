@@ -0,0 +1,49 @@
+package connpool
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// Pools published by PublishExpvar() by name.
+// expvar has no way to unpublish, so the published map of a closed pool is
+// reused by the next pool of the same name.
+var expvars = struct {
+	sync.Mutex
+	pools map[string]*atomic.Pointer[Pool]
+}{
+	pools: make(map[string]*atomic.Pointer[Pool]),
+}
+
+// Publish the statistics of the pool with expvar as a variable named
+// Pool.GetName(), so that they are shown by /debug/vars.
+//
+// The variable is a JSON object of the fields of Stats, taken from one Stats()
+// snapshot at every access. WaitDuration and EvictRunDuration are in
+// nanoseconds.
+//
+// It returns ErrDuplicateName if the name is published by another pool which
+// is not closed, or by someone else.
+func (self *Pool) PublishExpvar() error {
+	expvars.Lock()
+	defer expvars.Unlock()
+	if published, ok := expvars.pools[self.name]; ok {
+		if pool := published.Load(); pool != self && !pool.Closed() {
+			return self.wrapErr("publishexpvar", nil, ErrDuplicateName)
+		}
+		published.Store(self)
+		return nil
+	}
+	if expvar.Get(self.name) != nil {
+		return self.wrapErr("publishexpvar", nil, ErrDuplicateName)
+	}
+
+	published := &atomic.Pointer[Pool]{}
+	published.Store(self)
+	expvar.Publish(self.name, expvar.Func(func() any {
+		return published.Load().Stats()
+	}))
+	expvars.pools[self.name] = published
+	return nil
+}
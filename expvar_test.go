@@ -0,0 +1,64 @@
+package connpool_test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"testing"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+func readExpvar(t *testing.T, name string) connpool.Stats {
+	t.Helper()
+	v := expvar.Get(name)
+	if nil == v {
+		t.Fatalf("%v not published", name)
+	}
+	var stats connpool.Stats
+	if err := json.Unmarshal([]byte(v.String()), &stats); err != nil {
+		t.Fatalf("decode %v: %v", v.String(), err)
+	}
+	return stats
+}
+
+func TestPublishExpvar(t *testing.T) {
+	pool, _ := newTestPool(t, 2, 2)
+	if err := pool.PublishExpvar(); err != nil {
+		t.Fatalf("PublishExpvar: %v", err)
+	}
+	if err := pool.PublishExpvar(); err != nil {
+		t.Fatalf("PublishExpvar again: %v", err)
+	}
+	item := mustGet(t, pool)
+	connpooltest.WaitForIdle(t, pool, 1)
+	if stats := readExpvar(t, pool.GetName()); stats.TotalNum != 2 || stats.IdleNum != 1 || stats.CreatedNum != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	other := connpool.NewPool(pool.GetName(), connpooltest.NewFakeCreator(), 1, 1, 0)
+	defer other.Close()
+	if err := other.PublishExpvar(); !errors.Is(err, connpool.ErrDuplicateName) {
+		t.Fatalf("PublishExpvar of a duplicate name: %v", err)
+	}
+	// the name of a closed pool is taken over
+	item.Close()
+	pool.Close()
+	if err := other.PublishExpvar(); err != nil {
+		t.Fatalf("PublishExpvar after the pool is closed: %v", err)
+	}
+	if stats := readExpvar(t, pool.GetName()); stats.CreatedNum != 0 || stats.PoolClosedNum != 0 {
+		t.Fatalf("stats of the closed pool %+v", stats)
+	}
+}
+
+func TestPublishExpvarTaken(t *testing.T) {
+	expvar.NewInt(t.Name())
+	pool, _ := newTestPool(t, 1, 1)
+	err := pool.PublishExpvar()
+	var poolErr *connpool.PoolError
+	if !errors.Is(err, connpool.ErrDuplicateName) || !errors.As(err, &poolErr) || poolErr.Op != "publishexpvar" {
+		t.Fatalf("PublishExpvar of a name taken: %v", err)
+	}
+}
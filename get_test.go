@@ -0,0 +1,92 @@
+package connpool_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+func TestMaxWaiters(t *testing.T) {
+	creator := newGateCreator()
+	pool := connpool.NewPool(t.Name(), creator, 1, 1, 0)
+	creator.SetPool(pool, true)
+	pool.SetMaxWaiters(2)
+
+	errc := make(chan error, 3)
+	get := func() {
+		item, err := pool.Get()
+		if nil == err {
+			item.Close()
+		}
+		errc <- err
+	}
+	go get()
+	go get()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 2 })
+	_, err := pool.Get()
+	var poolErr *connpool.PoolError
+	if !errors.Is(err, connpool.ErrTooManyWaiters) || !errors.As(err, &poolErr) || poolErr.Op != "get" {
+		t.Fatalf("Get beyond max waiters: %v", err)
+	}
+	if n := pool.Stats().TooManyWaitersNum; n != 1 {
+		t.Fatalf("TooManyWaitersNum %v, want 1", n)
+	}
+
+	// both waiters are served by the item created
+	creator.release()
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+
+	// room for a waiter again
+	connpooltest.WaitForIdle(t, pool, 1)
+	item := mustGet(t, pool)
+	go get()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 1 })
+	item.Close()
+	if err := <-errc; err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	pool.Close()
+}
+
+func TestTryGet(t *testing.T) {
+	pool, creator := newTestPool(t, 2, 2)
+	if _, ok := pool.TryGet(false); ok || creator.NewItemNum() != 0 {
+		t.Fatalf("TryGet(false) of an empty pool created %v items", creator.NewItemNum())
+	}
+	// an item is created in background, but not waited for
+	if _, ok := pool.TryGet(true); ok {
+		t.Fatal("TryGet(true) of an empty pool got an item")
+	}
+	connpooltest.WaitForIdle(t, pool, 1)
+	item, ok := pool.TryGet(false)
+	if !ok {
+		t.Fatal("TryGet missed the idle item")
+	}
+	item.Close()
+
+	// an item failing Creator.InitItem() is not returned
+	creator.FailInitItem(errInit)
+	if _, ok := pool.TryGet(false); ok {
+		t.Fatal("TryGet got an item failing InitItem")
+	}
+	if n := pool.Stats().InitFailedNum; n != 1 {
+		t.Fatalf("InitFailedNum %v, want 1", n)
+	}
+
+	connpooltest.WaitForIdle(t, pool, 1)
+	pool.Pause("maintenance", false)
+	if _, ok := pool.TryGet(true); ok {
+		t.Fatal("TryGet got an item while paused")
+	}
+	pool.Resume()
+	pool.Close()
+	if _, ok := pool.TryGet(true); ok {
+		t.Fatal("TryGet got an item after closed")
+	}
+}
@@ -0,0 +1,250 @@
+package connpool_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+// A FakeClock running a function once at the next Now(), to run something
+// at a fixed point inside a pool method.
+type hookClock struct {
+	*connpooltest.FakeClock
+	onNow atomic.Pointer[func()]
+}
+
+func (self *hookClock) Now() time.Time {
+	if f := self.onNow.Swap(nil); f != nil {
+		(*f)()
+	}
+	return self.FakeClock.Now()
+}
+
+// No item of an old generation is left idle by the lock-free GiveBack() of a
+// sharded pool racing Invalidate() or SetCreator() with invalidate.
+func TestInvalidateRacesGiveBack(t *testing.T) {
+	for _, invalidate := range []func(pool *connpool.Pool){
+		(*connpool.Pool).Invalidate,
+		func(pool *connpool.Pool) {
+			creator := connpooltest.NewFakeCreator()
+			creator.SetPool(pool, false)
+			pool.SetCreator(creator, true)
+		},
+	} {
+		creator := connpooltest.NewFakeCreator()
+		pool := connpool.NewShardedPool(t.Name(), creator, 4, 4, 0, 2)
+		creator.SetPool(pool, false)
+		clock := &hookClock{FakeClock: connpooltest.NewFakeClock(time.Now())}
+		pool.SetClock(clock)
+
+		item := mustGet(t, pool)
+		// the item created in background after Get() uses the clock too
+		connpooltest.WaitForIdle(t, pool, 1)
+		// invalidate between the check of generation and the push
+		f := func() { invalidate(pool) }
+		clock.onNow.Store(&f)
+		pool.GiveBack(item)
+		if clock.onNow.Load() != nil {
+			t.Fatal("not invalidated by GiveBack()")
+		}
+		if info, ok := pool.ItemInfo(item); ok && info.State == connpool.StateIdle {
+			t.Fatalf("invalidated item left idle: %+v", info)
+		}
+		waitFor(t, item.Closed)
+		pool.Close()
+	}
+}
+
+func TestPauseFailFast(t *testing.T) {
+	pool, creator := newTestPool(t, 1, 1)
+	item := mustGet(t, pool)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := pool.Get()
+		errc <- err
+	}()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 1 })
+
+	// waiting Get() calls fail on Pause(), and so do new ones
+	pool.Pause("maintenance", false)
+	if err := <-errc; !errors.Is(err, connpool.ErrPoolPaused) {
+		t.Fatalf("waiting Get: %v", err)
+	}
+	if _, err := pool.Get(); !errors.Is(err, connpool.ErrPoolPaused) {
+		t.Fatalf("Get while paused: %v", err)
+	}
+	if stats := pool.Stats(); !stats.Paused || stats.PauseReason != "maintenance" {
+		t.Fatalf("stats while paused: %+v", stats)
+	}
+	// items given back are kept
+	item.Close()
+	connpooltest.WaitForIdle(t, pool, 1)
+
+	pool.Resume()
+	if again := mustGet(t, pool); again != item || creator.NewItemNum() != 1 {
+		t.Fatalf("got item %v after Resume, want the idle item %v", again.ID(), item.ID())
+	}
+	if stats := pool.Stats(); stats.Paused || stats.PauseReason != "" {
+		t.Fatalf("stats after Resume: %+v", stats)
+	}
+}
+
+func TestPauseWait(t *testing.T) {
+	pool, creator := newTestPool(t, 1, 1)
+	mustGet(t, pool).Close()
+	connpooltest.WaitForIdle(t, pool, 1)
+	pool.SetPauseWait(true)
+	pool.Pause("maintenance", false)
+
+	// Get() waits for Resume() even with an idle item
+	items := make(chan connpool.PoolItem, 2)
+	errc := make(chan error, 2)
+	get := func() {
+		item, err := pool.Get()
+		if err != nil {
+			errc <- err
+			return
+		}
+		items <- item
+	}
+	go get()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 1 })
+	pool.Resume()
+	(<-items).Close()
+	if n := creator.NewItemNum(); n != 1 {
+		t.Fatalf("%v items created, want the idle one only", n)
+	}
+
+	// waiting Get() calls fail once waiting is turned off during a pause
+	pool.Pause("maintenance", false)
+	go get()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 1 })
+	pool.SetPauseWait(false)
+	if err := <-errc; !errors.Is(err, connpool.ErrPoolPaused) {
+		t.Fatalf("waiting Get: %v", err)
+	}
+	pool.Resume()
+}
+
+func TestPauseCloseIdle(t *testing.T) {
+	pool, creator := newTestPool(t, 2, 2)
+	idle := mustGet(t, pool)
+	borrowed := mustGet(t, pool)
+	idle.Close()
+	pool.Pause("maintenance", true)
+	waitFor(t, idle.Closed)
+	if err := idle.GetErr(); !errors.Is(err, connpool.ErrPoolPaused) {
+		t.Fatalf("idle item closed with %v", err)
+	}
+	if borrowed.Closed() || !pool.IsItemActive(borrowed) {
+		t.Fatal("borrowed item closed by Pause")
+	}
+
+	// no replacement is created while paused
+	borrowed.Close()
+	connpooltest.WaitForIdle(t, pool, 1)
+	connpooltest.WaitForTotal(t, pool, 1)
+	if n := creator.NewItemNum(); n != 2 {
+		t.Fatalf("%v items created while paused", n)
+	}
+	pool.Resume()
+	if again := mustGet(t, pool); again != borrowed {
+		t.Fatalf("got item %v after Resume, want the idle item %v", again.ID(), borrowed.ID())
+	}
+}
+
+func TestSetCreator(t *testing.T) {
+	pool, old := newTestPool(t, 1, 1)
+	item := mustGet(t, pool)
+	creator := connpooltest.NewFakeCreator()
+	creator.SetPool(pool, true)
+	if err := pool.SetCreator(creator, false); err != nil {
+		t.Fatalf("SetCreator: %v", err)
+	}
+
+	// the old creator is kept while it has items
+	item.Close()
+	if again := mustGet(t, pool); again != item || old.InitItemNum() != 2 || creator.InitItemNum() != 0 {
+		t.Fatal("old item not reused with the old creator")
+	}
+	if old.Closed() {
+		t.Fatal("old creator closed before its last item")
+	}
+	item.SetErr(errUse)
+	item.Close()
+	waitFor(t, old.Closed)
+
+	// the replacement is created by the new creator
+	connpooltest.WaitForIdle(t, pool, 1)
+	if old.NewItemNum() != 1 || creator.NewItemNum() != 1 {
+		t.Fatalf("items created by the old creator %v, by the new one %v", old.NewItemNum(), creator.NewItemNum())
+	}
+
+	// replacing with invalidate closes the idle item and then its creator
+	next := connpooltest.NewFakeCreator()
+	next.SetPool(pool, true)
+	if err := pool.SetCreator(next, true); err != nil {
+		t.Fatalf("SetCreator: %v", err)
+	}
+	waitFor(t, creator.Closed)
+	if !creator.Items()[0].Closed() || next.Closed() {
+		t.Fatal("invalidated item not closed before its creator")
+	}
+
+	pool.Close()
+	if err := pool.SetCreator(connpooltest.NewFakeCreator(), false); !errors.Is(err, connpool.ErrPoolClosed) {
+		t.Fatalf("SetCreator after Close: %v", err)
+	}
+}
+
+// Evict() closes an idle item at once and a borrowed one when given back,
+// without creating replacements.
+func TestEvict(t *testing.T) {
+	for _, sharded := range []bool{false, true} {
+		creator := connpooltest.NewFakeCreator()
+		var pool *connpool.Pool
+		if sharded {
+			pool = connpool.NewShardedPool(t.Name(), creator, 2, 2, 0, 4)
+		} else {
+			pool = connpool.NewPool(t.Name(), creator, 2, 2, 0)
+		}
+		creator.SetPool(pool, true)
+		borrowed := mustGet(t, pool)
+		idle := mustGet(t, pool)
+		idle.Close()
+		connpooltest.WaitForIdle(t, pool, 1)
+
+		reason := errors.New("draining")
+		if err := pool.Evict(idle, reason); err != nil {
+			t.Fatalf("Evict: %v", err)
+		}
+		waitFor(t, idle.Closed)
+		if err := idle.GetErr(); !errors.Is(err, reason) {
+			t.Fatalf("idle item closed with %v", err)
+		}
+		if err := pool.Evict(borrowed, nil); err != nil {
+			t.Fatalf("Evict: %v", err)
+		}
+		if borrowed.Closed() || !pool.IsItemActive(borrowed) {
+			t.Fatal("borrowed item closed by Evict")
+		}
+		if err := borrowed.Close(); !errors.Is(err, connpool.ErrEvicted) {
+			t.Fatalf("Close of an evicted item: %v", err)
+		}
+		connpooltest.WaitForTotal(t, pool, 0)
+		if n := creator.NewItemNum(); n != 2 {
+			t.Fatalf("%v items created, want no replacement", n)
+		}
+		if n := pool.Stats().EvictedNum; n != 2 {
+			t.Fatalf("EvictedNum %v, want 2", n)
+		}
+		if err := pool.Evict(borrowed, nil); !errors.Is(err, connpool.ErrInvalidItem) {
+			t.Fatalf("Evict of a cleared item: %v", err)
+		}
+		pool.Close()
+	}
+}
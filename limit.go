@@ -0,0 +1,48 @@
+package connpool
+
+import (
+	"time"
+)
+
+// Token bucket limiting the rate of item creations.
+// rate <= 0 means no limit.
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (self *tokenBucket) set(rate float64, burst int, now time.Time) {
+	if burst < 1 {
+		burst = 1
+	}
+	self.rate = rate
+	self.burst = float64(burst)
+	self.tokens = self.burst
+	self.last = now
+}
+
+// Take a token at now.
+// Return 0 on success, otherwise the time to wait for the next token.
+func (self *tokenBucket) take(now time.Time) time.Duration {
+	if self.rate <= 0 {
+		return 0
+	}
+	if elapsed := now.Sub(self.last); elapsed > 0 {
+		self.tokens += elapsed.Seconds() * self.rate
+		if self.tokens > self.burst {
+			self.tokens = self.burst
+		}
+	}
+	self.last = now
+	if self.tokens >= 1 {
+		self.tokens--
+		return 0
+	}
+	wait := time.Duration((1 - self.tokens) / self.rate * float64(time.Second))
+	if wait <= 0 {
+		wait = time.Nanosecond
+	}
+	return wait
+}
@@ -0,0 +1,188 @@
+package connpool
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Wraps a Creator to add behaviors around its methods, e.g., logging and
+// metrics, so that they need not be coded in every Creator.
+type Middleware func(Creator) Creator
+
+// Wrap creator with middlewares, the first one being the outermost.
+//
+// The wrapped Creator implements ContextCreator, and passes the context down
+// to creator if creator implements ContextCreator too. It also implements
+// Resetter, calling that of creator if any.
+//
+//	creator := connpool.Chain(myCreator,
+//		connpool.WithLogging(log.Printf),
+//		connpool.WithRetry(3, 100*time.Millisecond),
+//		connpool.WithCreateTimeout(5*time.Second),
+//	)
+func Chain(creator Creator, middlewares ...Middleware) Creator {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		creator = middlewares[i](creator)
+	}
+	return creator
+}
+
+// Creator with some methods replaced, the others calling the wrapped one.
+type wrappedCreator struct {
+	Creator
+	newItem  func(ctx context.Context) (PoolItem, error)
+	initItem func(ctx context.Context, item PoolItem, n uint64) error
+}
+
+func (self *wrappedCreator) NewItem() (PoolItem, error) {
+	return self.NewItemContext(context.Background())
+}
+
+func (self *wrappedCreator) InitItem(item PoolItem, n uint64) error {
+	return self.InitItemContext(context.Background(), item, n)
+}
+
+func (self *wrappedCreator) NewItemContext(ctx context.Context) (PoolItem, error) {
+	if nil == self.newItem {
+		return newItemContext(ctx, self.Creator)
+	}
+	return self.newItem(ctx)
+}
+
+func (self *wrappedCreator) InitItemContext(ctx context.Context, item PoolItem, n uint64) error {
+	if nil == self.initItem {
+		return initItemContext(ctx, self.Creator, item, n)
+	}
+	return self.initItem(ctx, item, n)
+}
+
+func (self *wrappedCreator) ResetItem(item PoolItem) error {
+	return resetItem(self.Creator, item)
+}
+
+// Report the duration and result of every NewItem() and InitItem() call to
+// observe, op being "NewItem" or "InitItem".
+func WithTiming(observe func(op string, d time.Duration, err error)) Middleware {
+	return func(creator Creator) Creator {
+		return &wrappedCreator{
+			Creator: creator,
+			newItem: func(ctx context.Context) (PoolItem, error) {
+				start := time.Now()
+				item, err := newItemContext(ctx, creator)
+				observe("NewItem", time.Since(start), err)
+				return item, err
+			},
+			initItem: func(ctx context.Context, item PoolItem, n uint64) error {
+				start := time.Now()
+				err := initItemContext(ctx, creator, item, n)
+				observe("InitItem", time.Since(start), err)
+				return err
+			},
+		}
+	}
+}
+
+// Make NewItem() fail with ErrCreateTimeout if it takes longer than timeout.
+//
+// A ContextCreator gets a context cancelled on timeout. Any other Creator
+// keeps running NewItem() in its own goroutine, and an item it creates too
+// late is discarded by calling SetErr(ErrCreateTimeout) and Close() on it.
+func WithCreateTimeout(timeout time.Duration) Middleware {
+	type result struct {
+		item PoolItem
+		err  error
+	}
+	return func(creator Creator) Creator {
+		return &wrappedCreator{
+			Creator: creator,
+			newItem: func(ctx context.Context) (PoolItem, error) {
+				ctx, cancel := context.WithTimeoutCause(ctx, timeout, ErrCreateTimeout)
+				defer cancel()
+				chanResult := make(chan result)
+				chanDone := make(chan struct{})
+				go func() {
+					item, err := newItemContext(ctx, creator)
+					select {
+					case chanResult <- result{item, err}:
+					case <-chanDone:
+						if item != nil {
+							item.SetErr(ErrCreateTimeout)
+							item.Close()
+						}
+					}
+				}()
+				var r result
+				select {
+				case r = <-chanResult:
+				case <-ctx.Done():
+					close(chanDone)
+					// the result may have been sent just before
+					select {
+					case r = <-chanResult:
+					default:
+						r.err = ctx.Err()
+					}
+				}
+				if r.err != nil && errors.Is(context.Cause(ctx), ErrCreateTimeout) {
+					r.err = ErrCreateTimeout
+				}
+				return r.item, r.err
+			},
+		}
+	}
+}
+
+// Retry a failed NewItem() up to attempts times in total, sleeping backoff
+// before the first retry and doubling it before each next one.
+// Retrying stops when the context of NewItemContext() is done.
+func WithRetry(attempts int, backoff time.Duration) Middleware {
+	return func(creator Creator) Creator {
+		return &wrappedCreator{
+			Creator: creator,
+			newItem: func(ctx context.Context) (PoolItem, error) {
+				wait := backoff
+				for i := 1; ; i++ {
+					item, err := newItemContext(ctx, creator)
+					if nil == err || i >= attempts {
+						return item, err
+					}
+					timer := time.NewTimer(wait)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						return nil, err
+					case <-timer.C:
+					}
+					wait *= 2
+				}
+			},
+		}
+	}
+}
+
+// Log every failed NewItem() and InitItem() call, and every created item,
+// with logf, e.g., log.Printf.
+func WithLogging(logf func(format string, args ...interface{})) Middleware {
+	return func(creator Creator) Creator {
+		return &wrappedCreator{
+			Creator: creator,
+			newItem: func(ctx context.Context) (PoolItem, error) {
+				item, err := newItemContext(ctx, creator)
+				if err != nil {
+					logf("connpool: NewItem error:%v", err)
+				} else {
+					logf("connpool: NewItem item:%p", item)
+				}
+				return item, err
+			},
+			initItem: func(ctx context.Context, item PoolItem, n uint64) error {
+				err := initItemContext(ctx, creator, item, n)
+				if err != nil {
+					logf("connpool: InitItem error, item:%p, n:%v, err:%v", item, n, err)
+				}
+				return err
+			},
+		}
+	}
+}
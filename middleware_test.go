@@ -0,0 +1,185 @@
+package connpool_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+// A Creator without the optional interfaces of the one it wraps.
+type plainCreator struct {
+	connpool.Creator
+}
+
+// A Middleware recording the name of every NewItem() call passing through.
+func tracing(name string, calls *[]string) connpool.Middleware {
+	return func(creator connpool.Creator) connpool.Creator {
+		return &tracingCreator{plainCreator{creator}, name, calls}
+	}
+}
+
+type tracingCreator struct {
+	plainCreator
+	name  string
+	calls *[]string
+}
+
+func (self *tracingCreator) NewItem() (connpool.PoolItem, error) {
+	*self.calls = append(*self.calls, self.name)
+	return self.Creator.NewItem()
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	creator := connpool.Chain(connpooltest.NewFakeCreator(), tracing("a", &calls), tracing("b", &calls))
+	if _, err := creator.NewItem(); err != nil {
+		t.Fatalf("NewItem: %v", err)
+	}
+	if fmt.Sprint(calls) != "[a b]" {
+		t.Fatalf("middlewares called in order %v", calls)
+	}
+
+	fake := connpooltest.NewFakeCreator()
+	fake.FailResetItem(errUse)
+	creator = connpool.Chain(fake, connpool.WithRetry(1, 0))
+	if _, ok := creator.(connpool.ContextCreator); !ok {
+		t.Fatal("chained creator is not a ContextCreator")
+	}
+	if err := creator.(connpool.Resetter).ResetItem(nil); err != errUse || fake.ResetItemNum() != 1 {
+		t.Fatalf("ResetItem: %v", err)
+	}
+}
+
+func TestWithTiming(t *testing.T) {
+	fake := connpooltest.NewFakeCreator()
+	fake.SetNewItemLatency(10 * time.Millisecond)
+	fake.FailInitItem(errInit)
+	var ops []string
+	creator := connpool.Chain(fake, connpool.WithTiming(func(op string, d time.Duration, err error) {
+		ops = append(ops, fmt.Sprintf("%v %v", op, err))
+		if op == "NewItem" && d < 10*time.Millisecond {
+			t.Errorf("NewItem took %v, want at least the latency", d)
+		}
+	}))
+	item, err := creator.NewItem()
+	if err != nil {
+		t.Fatalf("NewItem: %v", err)
+	}
+	creator.InitItem(item, 1)
+	if want := fmt.Sprintf("[NewItem <nil> InitItem %v]", errInit); fmt.Sprint(ops) != want {
+		t.Fatalf("observed %v, want %v", ops, want)
+	}
+}
+
+func TestWithCreateTimeout(t *testing.T) {
+	// a ContextCreator is cancelled on timeout
+	fake := connpooltest.NewFakeCreator()
+	fake.SetNewItemLatency(time.Hour)
+	creator := connpool.Chain(fake, connpool.WithCreateTimeout(10*time.Millisecond))
+	if _, err := creator.NewItem(); err != connpool.ErrCreateTimeout {
+		t.Fatalf("NewItem: %v", err)
+	}
+	if len(fake.Items()) != 0 {
+		t.Fatal("item created after timeout")
+	}
+
+	// an item created too late by any other Creator is discarded
+	fake = connpooltest.NewFakeCreator()
+	fake.SetNewItemLatency(50 * time.Millisecond)
+	creator = connpool.Chain(plainCreator{fake}, connpool.WithCreateTimeout(10*time.Millisecond))
+	if _, err := creator.NewItem(); err != connpool.ErrCreateTimeout {
+		t.Fatalf("NewItem: %v", err)
+	}
+	waitFor(t, func() bool { return len(fake.Items()) == 1 && fake.Items()[0].Closed() })
+	if err := fake.Items()[0].GetErr(); err != connpool.ErrCreateTimeout {
+		t.Fatalf("discarded item has error %v", err)
+	}
+
+	// an item created around the timeout is either returned or discarded
+	fake = connpooltest.NewFakeCreator()
+	fake.SetNewItemLatency(time.Millisecond)
+	creator = connpool.Chain(plainCreator{fake}, connpool.WithCreateTimeout(time.Millisecond))
+	returned := make(map[connpool.PoolItem]bool)
+	for i := 0; i < 100; i++ {
+		item, err := creator.NewItem()
+		switch {
+		case nil == err && item != nil:
+			returned[item] = true
+		case err != connpool.ErrCreateTimeout || item != nil:
+			t.Fatalf("NewItem: %v, %v", item, err)
+		}
+	}
+	waitFor(t, func() bool {
+		for _, item := range fake.Items() {
+			if item.Closed() == returned[item] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestWithRetry(t *testing.T) {
+	fake := connpooltest.NewFakeCreator()
+	fake.FailNewItem(errDial, errDial)
+	creator := connpool.Chain(fake, connpool.WithRetry(3, time.Millisecond))
+	if _, err := creator.NewItem(); err != nil || fake.NewItemNum() != 3 {
+		t.Fatalf("NewItem: %v after %v calls", err, fake.NewItemNum())
+	}
+
+	fake = connpooltest.NewFakeCreator()
+	fake.FailNewItem(errDial, errDial)
+	creator = connpool.Chain(fake, connpool.WithRetry(2, time.Millisecond))
+	if _, err := creator.NewItem(); err != errDial || fake.NewItemNum() != 2 {
+		t.Fatalf("NewItem: %v after %v calls", err, fake.NewItemNum())
+	}
+
+	// no more retries once the context is done
+	fake = connpooltest.NewFakeCreator()
+	fake.FailNewItem(errDial, errDial)
+	creator = connpool.Chain(fake, connpool.WithRetry(3, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := creator.(connpool.ContextCreator).NewItemContext(ctx); err != errDial || fake.NewItemNum() != 1 {
+		t.Fatalf("NewItemContext: %v after %v calls", err, fake.NewItemNum())
+	}
+}
+
+func TestWithLogging(t *testing.T) {
+	fake := connpooltest.NewFakeCreator()
+	fake.FailNewItem(errDial)
+	fake.FailInitItem(errInit)
+	var mu sync.Mutex
+	var logs []string
+	creator := connpool.Chain(fake, connpool.WithLogging(func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}))
+	if _, err := creator.NewItem(); err != errDial {
+		t.Fatalf("NewItem: %v", err)
+	}
+	item, err := creator.NewItem()
+	if err != nil {
+		t.Fatalf("NewItem: %v", err)
+	}
+	creator.InitItem(item, 1)
+	creator.InitItem(item, 2)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 3 {
+		t.Fatalf("logs %q", logs)
+	}
+	for i, want := range []string{errDial.Error(), "NewItem item:", errInit.Error()} {
+		if !strings.Contains(logs[i], want) {
+			t.Fatalf("log %q, want %q", logs[i], want)
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package connpool
 
 import (
+	"container/list"
+	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -48,29 +54,406 @@ type Creator interface {
 	Close() error
 }
 
+// Optional interface of Creator, detected by type assertion.
+//
+// If a Creator implements it, connpool calls NewItemContext() and
+// InitItemContext() instead of NewItem() and InitItem(). The context is
+// cancelled when the pool is closed, and for NewItemContext(), also when the
+// timeout set by Pool.SetCreateTimeout() expires, with context.Cause()
+// returning ErrCreateTimeout, so that a hanging dial does not hold capacity
+// of the pool.
+//
+// The methods are named differently from those of Creator since a type can't
+// have two methods of the same name.
+type ContextCreator interface {
+	NewItemContext(ctx context.Context) (PoolItem, error)
+	InitItemContext(ctx context.Context, item PoolItem, n uint64) error
+}
+
+// Call NewItemContext() if creator is a ContextCreator, otherwise NewItem().
+func newItemContext(ctx context.Context, creator Creator) (PoolItem, error) {
+	if c, ok := creator.(ContextCreator); ok {
+		return c.NewItemContext(ctx)
+	}
+	return creator.NewItem()
+}
+
+// Call InitItemContext() if creator is a ContextCreator, otherwise InitItem().
+func initItemContext(ctx context.Context, creator Creator, item PoolItem, n uint64) error {
+	if c, ok := creator.(ContextCreator); ok {
+		return c.InitItemContext(ctx, item, n)
+	}
+	return creator.InitItem(item, n)
+}
+
+// Optional interface of Creator, detected by type assertion.
+//
+// If a Creator implements it, ResetItem() is called when a borrowed item is
+// given back, before it is put back to idle items, to clean per-use state such
+// as open transactions or pending buffers. If it returns an error, the item is
+// closed with the error instead of being reused. It is not called on items
+// closed instead of being reused, e.g. when the pool is closed or the item
+// reached max uses.
+type Resetter interface {
+	ResetItem(item PoolItem) error
+}
+
+func resetItem(creator Creator, item PoolItem) error {
+	if r, ok := creator.(Resetter); ok {
+		return r.ResetItem(item)
+	}
+	return nil
+}
+
+// Optional callbacks invoked on item lifecycle events, set by Pool.SetHooks().
+// Any of them can be nil.
+//
+// Hooks are called without holding any lock of the pool, but they should
+// return quickly and must not call back into the same item. They may run on
+// goroutines other than the caller's, and concurrently with each other:
+//
+// OnCreate is called on the background goroutine creating the item.
+//
+// OnBorrow is called by Get() on its caller's goroutine.
+//
+// OnReturn is called by GiveBackSync() on its caller's goroutine and by
+// GiveBack() on a new goroutine, except that GiveBack() of a sharded pool may
+// call it directly, see NewShardedPool().
+//
+// OnClose is called on a new goroutine right before PoolItem.Close().
+//
+// OnDiscard is called by ClearItemSync() on its caller's goroutine and by
+// ClearItem() on a new goroutine. Both are usually called by PoolItem.Close(),
+// so OnDiscard follows OnClose for items closed by connpool.
+type Hooks struct {
+	// Called after Creator.NewItem() created an item successfully.
+	OnCreate func(item PoolItem)
+
+	// Called before Pool.Get() returns an item.
+	// wait is the time spent in Pool.Get(),
+	// useCount is the use count passed to Creator.InitItem().
+	OnBorrow func(item PoolItem, wait time.Duration, useCount uint64)
+
+	// Called after an item is given back to idle items by Pool.GiveBack().
+	OnReturn func(item PoolItem)
+
+	// Called when an item is cleared from the pool by Pool.ClearItem().
+	// err is the error returned by PoolItem.GetErr().
+	OnDiscard func(item PoolItem, err error)
+
+	// Called when connpool closes an item.
+	// reason is a *PoolError wrapping ErrIdleTimeout, ErrIdleFull,
+	// ErrPoolClosed etc. or the error returned by Creator.InitItem().
+	OnClose func(item PoolItem, reason error)
+}
+
+// What GiveBack() does with an item when idle items are full,
+// set by Pool.SetIdleFullPolicy().
+type IdleFullPolicy int
+
+const (
+	// Wait for room in idle items, and close the item with ErrIdleFull on
+	// timeout. This is the default policy, waiting up to 10 seconds.
+	IdleFullWait IdleFullPolicy = iota
+	// Close the item with ErrIdleFull immediately.
+	IdleFullClose
+	// Close the oldest idle item with ErrIdleFull to make room for the item.
+	IdleFullEvictOldest
+)
+
+func (self IdleFullPolicy) String() string {
+	switch self {
+	case IdleFullWait:
+		return "wait"
+	case IdleFullClose:
+		return "close"
+	case IdleFullEvictOldest:
+		return "evict-oldest"
+	}
+	return "unknown"
+}
+
+func (self IdleFullPolicy) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Settings of a pool, returned by Pool.Config().
+type Config struct {
+	Name           string
+	MaxTotalNum    int
+	MaxIdleNum     int
+	IdleTimeout    int // in second
+	ShardNum       int
+	GetTimeout     int // in second
+	IdleFullPolicy IdleFullPolicy
+	IdleFullWait   time.Duration
+	CreateTimeout  time.Duration
+	MaxConnecting  int
+	CreateRate     float64 // creations per second, 0 means no limit
+	CreateBurst    int
+	MaxWaiters     int
+	MaxUses        uint64
+	PauseWait      bool
+	EvictInterval  time.Duration // 0 means min(IdleTimeout, 10) seconds
+	EvictScanNum   int
+	MinIdle        int
+}
+
+// Statistics of a pool, returned by Pool.Stats().
+type Stats struct {
+	TotalNum    int // same as Pool.GetTotalNum()
+	IdleNum     int // same as Pool.GetIdleNum()
+	CreatingNum int // items being created by Creator.NewItem()
+	WaiterNum   int // Get() calls waiting for an item
+
+	Paused      bool   // Pause() is called without Resume()
+	PauseReason string // the reason passed to Pause()
+	Generation  uint64 // times Invalidate() is called
+
+	WaitNum           uint64        // Get() calls which had to wait for an item
+	WaitDuration      time.Duration // total time Get() calls spent waiting
+	TooManyWaitersNum uint64        // Get() calls failed with ErrTooManyWaiters
+
+	CreatedNum      uint64 // items created by Creator.NewItem()
+	CreateFailedNum uint64 // failed Creator.NewItem() calls
+
+	ClosedNum            uint64 // items closed by the pool for any reason
+	IdleTimeoutClosedNum uint64 // items closed with ErrIdleTimeout
+	PoolClosedNum        uint64 // items closed with ErrPoolClosed
+	InvalidatedNum       uint64 // items closed with ErrInvalidated
+	EvictedNum           uint64 // items evicted by Evict()
+	InitFailedNum        uint64 // items closed for errors of Creator.InitItem()
+	ResetFailedNum       uint64 // items closed for errors of Resetter.ResetItem()
+	ClearedNum           uint64 // borrowed items cleared by ClearItem()
+	MaxUsesClosedNum     uint64 // items closed with ErrMaxUses
+
+	IdleFullNum        uint64 // times GiveBack() found idle items full
+	IdleFullWaitedNum  uint64 // times GiveBack() got room in idle items by waiting
+	IdleFullEvictedNum uint64 // idle items closed to make room for GiveBack()
+	IdleFullClosedNum  uint64 // items closed by GiveBack() with ErrIdleFull
+
+	EvictRunNum       uint64        // checks of idle items for idle timeout
+	EvictRunDuration  time.Duration // time spent by the last check
+	EvictRunClosedNum uint64        // items closed by the last check
+}
+
+// Counters of Stats.
+type poolStats struct {
+	wait            atomic.Uint64
+	waitNanos       atomic.Int64
+	tooManyWaiters  atomic.Uint64
+	created         atomic.Uint64
+	createFailed    atomic.Uint64
+	closed          atomic.Uint64
+	idleTimeout     atomic.Uint64
+	poolClosed      atomic.Uint64
+	invalidated     atomic.Uint64
+	evicted         atomic.Uint64
+	initFailed      atomic.Uint64
+	resetFailed     atomic.Uint64
+	cleared         atomic.Uint64
+	maxUsesClosed   atomic.Uint64
+	idleFull        atomic.Uint64
+	idleFullWaited  atomic.Uint64
+	idleFullEvicted atomic.Uint64
+	idleFullClosed  atomic.Uint64
+	evictRun        atomic.Uint64
+	evictRunNanos   atomic.Int64
+	evictRunClosed  atomic.Uint64
+}
+
+// State of an item managed by the pool.
+//
+// The transitions are:
+//
+//	idle       -> validating  Get() takes the item from idle items
+//	idle       -> closing     idle timeout, pool closed, paused, invalidated or evicted
+//	idle       -> closed      ClearItem() of an idle item, e.g. one broken in background
+//	validating -> borrowed    Creator.InitItem() succeeded
+//	validating -> closing     Creator.InitItem() failed, idle timeout, max uses, invalidated, evicted
+//	validating -> closed      ClearItem() called from Creator.InitItem()
+//	borrowed   -> idle        GiveBack()
+//	borrowed   -> validating  GiveBack() hands the item to a waiting Get()
+//	borrowed   -> closing     GiveBack() with idle items full, max uses, invalidated, evicted,
+//	                          Resetter.ResetItem() failed or pool closed
+//	borrowed   -> closed      ClearItem() by user
+//	closing    -> closed      ClearItem() called from PoolItem.Close()
+//
+// A newly created item starts in idle or, if a Get() is waiting, in validating.
+//
+// The state of an item in idle items only changes with the lock of its shard
+// held. Other transitions into closing or closed use compare-and-swap, as they
+// may race each other. The rest are made by the only goroutine owning the item,
+// the one creating, validating or giving it back.
+type ItemState int32
+
+const (
+	StateIdle ItemState = iota
+	StateBorrowed
+	StateValidating
+	StateClosing
+	StateClosed
+)
+
+func (self ItemState) String() string {
+	switch self {
+	case StateIdle:
+		return "idle"
+	case StateBorrowed:
+		return "borrowed"
+	case StateValidating:
+		return "validating"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+func (self ItemState) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Read-only snapshot of the bookkeeping of an item,
+// returned by Pool.ItemInfo() and Pool.Snapshot().
+type ItemInfo struct {
+	Item         PoolItem
+	ID           uint64 // sequence number in the pool, starting from 1
+	Generation   uint64 // value of Stats.Generation when the item was created
+	State        ItemState
+	CreatedAt    time.Time
+	LastBorrowed time.Time // zero if never returned by Get()
+	LastReturned time.Time // zero if never given back
+	UseCount     uint64    // times returned by Get()
+	LastErr      error     // error the item is closed or cleared with
+}
+
+// Bookkeeping of a pooled item, saved by PoolItem.SetContainer().
+//
+// The state is stored atomically. An item in idle items is owned by the
+// idleShard holding it and changes state only with the shard locked; otherwise
+// it is owned by the goroutine which took it out of idle items or borrowed it.
 type itemInfo struct {
-	item     PoolItem
-	active   bool
-	useCount uint64
-	idleTime int64
-	closed   bool
-	err      error
-	timer    *time.Timer
+	pool         *Pool
+	item         PoolItem
+	id           uint64 // written with Pool.mu held before being shared
+	creator      *poolCreator
+	generation   uint64
+	createdAt    time.Time
+	state        atomic.Int32
+	useCount     atomic.Uint64
+	idleTime     atomic.Int64 // in UnixNano
+	lastBorrowed atomic.Int64 // in UnixNano
+	lastReturned atomic.Int64 // in UnixNano
+	err          atomic.Pointer[error]
+	evicted      atomic.Pointer[error] // reason of Evict()
+}
+
+func (self *itemInfo) setErr(err error) {
+	self.err.Store(&err)
+}
+
+func (self *itemInfo) getErr() error {
+	if err := self.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func unixNanoTime(t int64) time.Time {
+	if 0 == t {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
+
+func (self *itemInfo) snapshot() ItemInfo {
+	return ItemInfo{
+		Item:         self.item,
+		ID:           self.id,
+		Generation:   self.generation,
+		State:        self.getState(),
+		CreatedAt:    self.createdAt,
+		LastBorrowed: unixNanoTime(self.lastBorrowed.Load()),
+		LastReturned: unixNanoTime(self.lastReturned.Load()),
+		UseCount:     self.useCount.Load(),
+		LastErr:      self.getErr(),
+	}
+}
+
+func (self *itemInfo) getState() ItemState {
+	return ItemState(self.state.Load())
+}
+
+func (self *itemInfo) setState(state ItemState) {
+	self.state.Store(int32(state))
+}
+
+func (self *itemInfo) casState(from, to ItemState) bool {
+	return self.state.CompareAndSwap(int32(from), int32(to))
+}
+
+// Idle items of one shard, the most recently returned at the end.
+type idleShard struct {
+	mu    sync.Mutex
+	items []*itemInfo
+	_     [32]byte // keep shards on different cache lines
+}
+
+// A Creator of the pool and the number of its items alive or being created.
+type poolCreator struct {
+	Creator
+	numItems int  // under Pool.mu
+	replaced bool // replaced by SetCreator(), under Pool.mu
 }
 
 // The main pool struct.
 type Pool struct {
 	name        string
-	chanIdle    chan *itemInfo
-	chanToNew   chan struct{}
-	chanTotal   chan struct{}
 	maxTotalNum int
 	maxIdleNum  int
 	idleTimeout int
-	getTimeout  int
-	creator     Creator
 	chanClose   chan struct{}
-	timerPool   sync.Pool
+	ctx         context.Context // cancelled by Close()
+	cancel      context.CancelFunc
+	chanConfig  chan struct{} // notify checkIdle() of changed settings
+	shards      []*idleShard
+	sharded     bool
+
+	numIdle     atomic.Int64 // items in shards, including those being pushed
+	numWaiters  atomic.Int64 // mirror of waiters.Len() for lock-free checks
+	roomWaiters atomic.Int64
+	closed      atomic.Bool
+	paused      atomic.Bool
+	pauseWait   atomic.Bool
+	generation  atomic.Uint64 // increased by Invalidate()
+	maxUses     atomic.Uint64
+	clock       atomic.Pointer[Clock]
+	hooks       atomic.Pointer[Hooks]
+	stats       poolStats
+
+	mu             sync.Mutex
+	creator        *poolCreator
+	getTimeout     int
+	idleFullPolicy IdleFullPolicy
+	idleFullWait   time.Duration
+	createTimeout  time.Duration
+	maxConnecting  int
+	maxWaiters     int
+	createLimiter  tokenBucket
+	limitWaiting   bool          // a timer is set for the next token of createLimiter
+	waiters        list.List     // chan *itemInfo of Get() waiting for an item
+	chanRoom       chan struct{} // closed and renewed when room is made in idle items
+	numTotal       int           // items alive or being created
+	numCreating    int
+	items          map[*itemInfo]struct{} // items created and not cleared yet
+	lastID         uint64
+	retrying       bool
+	pauseReason    string
+	evictInterval  time.Duration
+	evictScanNum   int
+	minIdle        int
 }
 
 var (
@@ -78,21 +461,54 @@ var (
 	ErrIdleTimeout = errors.New("the item is idle timeout")
 	ErrIdleFull    = errors.New("idle items are full")
 	ErrGetTimeout  = errors.New("no item to get")
+	ErrInvalidItem = errors.New("item not from this pool")
+	ErrNotBorrowed = errors.New("the item is not borrowed")
+
+	ErrCreateTimeout  = errors.New("creating item timeout")
+	ErrTooManyWaiters = errors.New("too many waiters to get item")
+	ErrMaxUses        = errors.New("the item reached max uses")
+	ErrPoolPaused     = errors.New("the pool is paused")
+	ErrInvalidated    = errors.New("the item is invalidated")
+	ErrEvicted        = errors.New("the item is evicted")
 )
 
-func newInfoItem(poolItem PoolItem) *itemInfo {
-	infoItem := &itemInfo{
-		item:     poolItem,
-		active:   false,
-		useCount: 0,
-		idleTime: time.Now().Unix(),
-		closed:   false,
-		timer:    time.NewTimer(time.Second),
+// Error returned by methods of Pool, and passed to PoolItem.SetErr() when
+// connpool closes an item.
+//
+// Err is one of the errors above or an error from Creator or PoolItem, so
+// check it with errors.Is(), e.g. errors.Is(err, ErrPoolClosed), and get the
+// details with errors.As().
+type PoolError struct {
+	Pool   string // name of the pool
+	ItemID uint64 // ID of the item, 0 if no item is involved
+	Op     string // get, giveback, clear, evict, setcreator, register, publishexpvar, or close by connpool
+	Err    error
+}
+
+func (self *PoolError) Error() string {
+	if self.ItemID != 0 {
+		return fmt.Sprintf("connpool %v: %v item %v: %v", self.Pool, self.Op, self.ItemID, self.Err)
+	}
+	return fmt.Sprintf("connpool %v: %v: %v", self.Pool, self.Op, self.Err)
+}
+
+func (self *PoolError) Unwrap() error {
+	return self.Err
+}
+
+// Wrap err of op on info, which may be nil, into a *PoolError.
+func (self *Pool) wrapErr(op string, info *itemInfo, err error) error {
+	if nil == err {
+		return nil
+	}
+	if _, ok := err.(*PoolError); ok {
+		return err
 	}
-	if !infoItem.timer.Stop() {
-		<-infoItem.timer.C
+	poolErr := &PoolError{Pool: self.name, Op: op, Err: err}
+	if info != nil {
+		poolErr.ItemID = info.id
 	}
-	return infoItem
+	return poolErr
 }
 
 func (self *itemInfo) Close() error {
@@ -100,12 +516,11 @@ func (self *itemInfo) Close() error {
 }
 
 func (self *itemInfo) SetErr(err error) {
-	self.err = err
 	self.item.SetErr(err)
 }
 
 func (self *itemInfo) GetErr() error {
-	return self.err
+	return self.item.GetErr()
 }
 
 func (self *itemInfo) GetContainer() PoolItem {
@@ -117,7 +532,8 @@ func (self *itemInfo) SetContainer(container PoolItem) {
 
 // Create a connection pool.
 //
-// name is an unique id of this pool;
+// name is an unique id of this pool, which is enforced if the pool is
+// registered by Pool.Register();
 //
 // creator is the Creator interface implemented by user;
 //
@@ -132,7 +548,36 @@ func (self *itemInfo) SetContainer(container PoolItem) {
 // If an item is in idle state for at least idleTimeout seconds, the item will be
 // closed with error ErrIdleTimeout.
 func NewPool(name string, creator Creator, maxTotalNum int, maxIdleNum int, idleTimeout int) *Pool {
-	fmt.Printf("NewPool, name:%v, maxTotalNum:%v, maxIdleNum:%v, idleTimeout:%v\n", name, maxTotalNum, maxIdleNum, idleTimeout)
+	return newPool(name, creator, maxTotalNum, maxIdleNum, idleTimeout, 1)
+}
+
+// Create a connection pool for high throughput on many-core machines.
+//
+// Idle items are spread over shardNum shards, each with its own lock, and
+// Get() steals from other shards when the one picked is empty. shardNum <= 0 means
+// runtime.GOMAXPROCS(0). maxTotalNum and maxIdleNum are still enforced over the
+// whole pool.
+//
+// A shard is picked at random for every push and pop, without affinity to the
+// calling goroutine or P, so sharding only spreads the lock contention. Most of
+// the gain over NewPool() comes from GiveBack() not starting a goroutine.
+//
+// GiveBack() puts the item back without starting a goroutine when
+// no Get() is waiting and there is room in idle items, so Hooks.OnReturn may
+// be called by GiveBack() directly.
+//
+// The other parameters are the same as NewPool().
+func NewShardedPool(name string, creator Creator, maxTotalNum int, maxIdleNum int, idleTimeout int, shardNum int) *Pool {
+	if shardNum <= 0 {
+		shardNum = runtime.GOMAXPROCS(0)
+	}
+	pool := newPool(name, creator, maxTotalNum, maxIdleNum, idleTimeout, shardNum)
+	pool.sharded = true
+	return pool
+}
+
+func newPool(name string, creator Creator, maxTotalNum int, maxIdleNum int, idleTimeout int, shardNum int) *Pool {
+	fmt.Printf("NewPool, name:%v, maxTotalNum:%v, maxIdleNum:%v, idleTimeout:%v, shardNum:%v\n", name, maxTotalNum, maxIdleNum, idleTimeout, shardNum)
 	if maxIdleNum == maxTotalNum {
 		maxIdleNum = maxTotalNum + 1 //manage to be reused
 	}
@@ -141,373 +586,1414 @@ func NewPool(name string, creator Creator, maxTotalNum int, maxIdleNum int, idle
 		maxTotalNum: maxTotalNum,
 		maxIdleNum:  maxIdleNum,
 		idleTimeout: idleTimeout,
-		creator:     creator,
-		chanIdle:    make(chan *itemInfo, maxIdleNum),
-		chanToNew:   make(chan struct{}, 1),
-		chanTotal:   make(chan struct{}, maxTotalNum),
-		chanClose:   make(chan struct{}, 1),
+		creator:     &poolCreator{Creator: creator},
+		chanClose:   make(chan struct{}),
+		chanConfig:  make(chan struct{}, 1),
+		shards:      make([]*idleShard, shardNum),
+		chanRoom:    make(chan struct{}),
+		items:       make(map[*itemInfo]struct{}),
 	}
-	pool.timerPool.New = func() interface{} {
-		t := time.NewTimer(time.Second)
-		if !t.Stop() {
-			<-t.C
-		}
-		return t
+	pool.idleFullWait = time.Duration(10) * time.Second
+	pool.ctx, pool.cancel = context.WithCancel(context.Background())
+	for i := range pool.shards {
+		pool.shards[i] = &idleShard{}
 	}
-	go pool.newItem()
+	pool.SetClock(realClock{})
+	pool.hooks.Store(&Hooks{})
 	go pool.checkIdle()
 	return pool
 }
 
-func (self *Pool) newItem() {
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Printf("panic:%v, pool-name:%v, chanTotal closed?\n", e, self.name)
-		}
-	}()
-	for {
-		select {
-		case <-self.chanClose:
-			fmt.Printf("chanToNew closed, pool-name:%v\n", self.name)
+// Start creations for waiting Get() calls, and keep one item being created
+// when idle items run out, as long as maxTotalNum, maxConnecting and
+// createLimiter permit. The rest of the demand is left to the end of ongoing
+// creations or to the next token of createLimiter.
+func (self *Pool) maybeCreateLocked() {
+	if self.closed.Load() || self.paused.Load() {
+		return
+	}
+	want := self.waiters.Len() - self.numCreating
+	if want <= 0 && self.numIdle.Load() == 0 && self.numCreating == 0 {
+		want = 1
+	}
+	for ; want > 0 && self.numTotal < self.maxTotalNum; want-- {
+		if self.maxConnecting > 0 && self.numCreating >= self.maxConnecting {
 			return
-		case <-self.chanToNew:
 		}
-		select {
-		case itemTemp, ok := <-self.chanIdle:
-			if !ok {
-				return
-			}
-			self.chanIdle <- itemTemp
-			continue
-		case self.chanTotal <- struct{}{}:
+		if wait := self.createLimiter.take(self.getClock().Now()); wait > 0 {
+			self.waitLimiterLocked(wait)
+			return
 		}
-		go func() {
-			defer func() {
-				if e := recover(); e != nil {
-					fmt.Printf("panic:%v, pool-name:%v, chanIdle closed?\n", e, self.name)
-				}
-			}()
-			item, err := self.creator.NewItem()
-			if err != nil {
-				<-self.chanTotal
-				if len(self.chanTotal) < 1 {
-					time.Sleep(time.Second * time.Duration(2))
-					select {
-					case <-self.chanClose:
-					case self.chanToNew <- struct{}{}:
-					}
-				}
-				fmt.Printf("creator NewItem, pool-name:%v, error:%v\n", self.name, err)
-				return
-			}
-			itemInfo := newInfoItem(item)
-			item.SetContainer(itemInfo)
-			self.chanIdle <- itemInfo
-			fmt.Printf("newItem item:%p, pool-name:%v, chanTotal:%v, chanToNew:%v, chanIdle:%v\n", itemInfo, self.name, len(self.chanTotal), len(self.chanToNew), len(self.chanIdle))
-		}()
+		self.numTotal++
+		self.numCreating++
+		go self.createItem()
 	}
 }
 
-func (self *Pool) checkIdle() {
-	if self.idleTimeout <= 0 {
+func (self *Pool) waitLimiterLocked(wait time.Duration) {
+	if self.limitWaiting {
 		return
 	}
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Printf("pool closed, pool-name:%v, panic:%v\n", self.name, e)
-		}
-	}()
-	checkInterval := self.idleTimeout
-	if checkInterval > 10 {
-		checkInterval = 10
+	self.limitWaiting = true
+	self.getClock().AfterFunc(wait, func() {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+		self.limitWaiting = false
+		self.maybeCreateLocked()
+	})
+}
+
+// Retry creation 2 seconds after a failed one if Get() calls are still waiting.
+func (self *Pool) retryCreateLocked() {
+	if self.closed.Load() || self.retrying || self.waiters.Len() == 0 {
+		return
 	}
-	for {
-		select {
-		case itemTemp, ok := <-self.chanIdle:
-			if !ok {
-				return
-			}
-			if self.checkIdleTimeout(itemTemp) {
-				continue
-			}
-			_t := self.timerPool.Get()
-			t, _ := _t.(*time.Timer)
-			if nil == t {
-				t = time.NewTimer(time.Duration(self.idleTimeout) * time.Second)
-			} else {
-				t.Reset(time.Duration(self.idleTimeout) * time.Second)
-			}
-			select {
-			case self.chanIdle <- itemTemp:
-				if !t.Stop() {
-					<-t.C
-				}
-				self.timerPool.Put(t)
-			case <-t.C:
-				self.timerPool.Put(t)
-				self.closeItem(itemTemp, ErrIdleTimeout)
-				continue
-			}
-			time.Sleep(time.Duration(checkInterval) * time.Second)
+	self.retrying = true
+	self.getClock().AfterFunc(time.Second*time.Duration(2), func() {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+		self.retrying = false
+		self.maybeCreateLocked()
+	})
+}
+
+// Call Creator.NewItem() with the timeout set by SetCreateTimeout().
+func (self *Pool) newItem(creator Creator) (PoolItem, error) {
+	if _, ok := creator.(ContextCreator); !ok {
+		return creator.NewItem()
+	}
+	self.mu.Lock()
+	timeout := self.createTimeout
+	self.mu.Unlock()
+	if timeout <= 0 {
+		return newItemContext(self.ctx, creator)
+	}
+	ctx, cancel := context.WithCancelCause(self.ctx)
+	defer cancel(nil)
+	timer := self.getClock().AfterFunc(timeout, func() {
+		cancel(ErrCreateTimeout)
+	})
+	defer timer.Stop()
+	return newItemContext(ctx, creator)
+}
+
+func (self *Pool) createItem() {
+	self.mu.Lock()
+	creator := self.creator
+	creator.numItems++
+	generation := self.generation.Load()
+	self.mu.Unlock()
+	item, err := self.newItem(creator.Creator)
+	if err != nil {
+		fmt.Printf("creator NewItem, pool-name:%v, error:%v\n", self.name, err)
+		self.stats.createFailed.Add(1)
+		self.mu.Lock()
+		self.numTotal--
+		self.numCreating--
+		self.retryCreateLocked()
+		release := self.releaseCreatorLocked(creator)
+		self.mu.Unlock()
+		if release {
+			creator.Close()
 		}
+		return
+	}
+	self.stats.created.Add(1)
+	now := self.getClock().Now()
+	info := &itemInfo{
+		pool:       self,
+		item:       item,
+		creator:    creator,
+		generation: generation,
+		createdAt:  now,
+	}
+	info.idleTime.Store(now.UnixNano())
+	self.mu.Lock()
+	self.lastID++
+	info.id = self.lastID
+	self.items[info] = struct{}{}
+	self.mu.Unlock()
+	item.SetContainer(info)
+	if hooks := self.hooks.Load(); hooks.OnCreate != nil {
+		hooks.OnCreate(item)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.numCreating--
+	if self.closed.Load() {
+		self.closeItem(info, ErrPoolClosed)
+	} else if self.isInvalidated(info) {
+		self.closeItem(info, ErrInvalidated)
+	} else if !self.putLocked(info) {
+		self.closeItem(info, ErrIdleFull)
 	}
+	self.maybeCreateLocked()
 }
 
-// Set Get()'s timeout in second, 0 means no timeout, default 0.
-// Get() will return with error ErrGetTimeout on timeout.
-//
-// This method can be called after NewPool().
-func (self *Pool) SetGetTimeout(timeout int) {
-	self.getTimeout = timeout
+func (self *Pool) shardIndex() int {
+	if len(self.shards) == 1 {
+		return 0
+	}
+	return int(rand.Uint32() % uint32(len(self.shards)))
 }
 
-// Get pooled item originally created by Creator.NewItem().
-//
-// If SetGetTimeout() is called with non-zero value, Get() will return with
-// error ErrGetTimeout after timeout.
-func (self *Pool) Get() (_item PoolItem, _err error) {
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Printf("pool closed, pool-name:%v, panic:%v\n", self.name, e)
-			_item = nil
-			_err = ErrPoolClosed
+// Mark an item taken by Get() from idle items or from GiveBack().
+// No compare-and-swap is needed as the caller owns the item, see ItemState.
+func (self *itemInfo) borrow() {
+	self.setState(StateValidating)
+}
+
+// Put an item into idle items.
+// Return false if idle items are full.
+// The caller owns the item until it is pushed, see ItemState.
+func (self *Pool) pushIdle(info *itemInfo) bool {
+	if self.numIdle.Add(1) > int64(self.maxIdleNum) {
+		self.numIdle.Add(-1)
+		return false
+	}
+	shard := self.shards[self.shardIndex()]
+	shard.mu.Lock()
+	info.setState(StateIdle)
+	shard.items = append(shard.items, info)
+	shard.mu.Unlock()
+	return true
+}
+
+// Take the most recently returned item of a shard, stealing from other shards
+// if the chosen one is empty, and mark it validating.
+// Room is made in idle items if an item is returned, which the caller should
+// signal by signalRoom().
+func (self *Pool) popIdle() *itemInfo {
+	if self.numIdle.Load() <= 0 {
+		return nil
+	}
+	start := self.shardIndex()
+	for i := range self.shards {
+		shard := self.shards[(start+i)%len(self.shards)]
+		shard.mu.Lock()
+		if n := len(shard.items); n > 0 {
+			info := shard.items[n-1]
+			shard.items[n-1] = nil
+			shard.items = shard.items[:n-1]
+			info.borrow()
+			shard.mu.Unlock()
+			self.numIdle.Add(-1)
+			return info
 		}
-	}()
-	var item *itemInfo = nil
-	var ok bool
+		shard.mu.Unlock()
+	}
+	return nil
+}
+
+// Like popIdle(), but close idle timeout items and items beyond max uses on
+// the way, and signal the room made. locked tells whether Pool.mu is held.
+// Must not be called with shard locks held.
+func (self *Pool) popValidIdle(locked bool) *itemInfo {
 	for {
-		select {
-		case item, ok = <-self.chanIdle:
-			if !ok {
-				return nil, ErrPoolClosed
-			}
-		default:
-			select {
-			case self.chanToNew <- struct{}{}:
-			default:
-			}
+		info := self.popIdle()
+		if nil == info {
+			return nil
 		}
-		if item != nil {
-			if item.closed {
-				item = nil
-				continue
-			}
-			item.active = true
-			item.useCount++
-			if self.checkIdleTimeout(item) {
-				item = nil
-				continue
-			}
-			if err := self.creator.InitItem(item.item, item.useCount); err != nil {
-				fmt.Printf("InitItem error, item:%v, pool-name:%v, err:%v\n", item, self.name, err)
-				self.closeItem(item, err)
-				item = nil
-				continue
-			}
-			return item.item, nil
-		}
-		if self.getTimeout > 0 {
-			_t := self.timerPool.Get()
-			t, _ := _t.(*time.Timer)
-			if nil == t {
-				t = time.NewTimer(time.Duration(self.getTimeout) * time.Second)
-			} else {
-				t.Reset(time.Duration(self.getTimeout) * time.Second)
-			}
-			select {
-			case item, ok = <-self.chanIdle:
-				if !t.Stop() {
-					<-t.C
-				}
-				self.timerPool.Put(t)
-				if !ok {
-					return nil, ErrPoolClosed
-				}
-			case <-t.C:
-				self.timerPool.Put(t)
-				return nil, ErrGetTimeout
-			}
-		} else {
-			item, ok = <-self.chanIdle
-			if !ok {
-				return nil, ErrPoolClosed
-			}
+		self.signalRoom(locked)
+		if self.isIdleTimeout(info) {
+			self.closeItem(info, ErrIdleTimeout)
+			continue
 		}
-		select {
-		case self.chanToNew <- struct{}{}:
-		default:
+		if self.isInvalidated(info) {
+			self.closeItem(info, ErrInvalidated)
+			continue
 		}
-		if item != nil {
-			if item.closed {
-				item = nil
-				continue
-			}
-			item.active = true
-			item.useCount++
-			if self.checkIdleTimeout(item) {
-				item = nil
-				continue
-			}
-			if err := self.creator.InitItem(item.item, item.useCount); err != nil {
-				fmt.Printf("InitItem error, item:%v, pool-name:%v, err:%v\n", item, self.name, err)
-				self.closeItem(item, err)
-				item = nil
-				continue
-			}
-			return item.item, nil
+		if reason := info.evicted.Load(); reason != nil {
+			self.closeItem(info, *reason)
+			continue
+		}
+		if self.isMaxUses(info) {
+			self.stats.maxUsesClosed.Add(1)
+			self.closeItem(info, ErrMaxUses)
+			continue
 		}
+		return info
 	}
 }
 
-func (self *Pool) checkIdleTimeout(item *itemInfo) bool {
-	if self.idleTimeout <= 0 {
-		return false
-	}
-	if item.idleTime <= 0 {
-		return false
-	}
-	markTime := time.Now().Unix() - int64(self.idleTimeout)
-	if item.idleTime <= markTime {
-		self.closeItem(item, ErrIdleTimeout)
-		return true
-	}
-	return false
+// Whether the item was created before the last Invalidate().
+func (self *Pool) isInvalidated(info *itemInfo) bool {
+	return info.generation != self.generation.Load()
 }
 
-func (self *Pool) closeItem(item *itemInfo, err error) {
-	go func() {
-		item.SetErr(err)
-		item.Close()
-	}()
+// Whether an item has been returned by Get() for max uses.
+func (self *Pool) isMaxUses(info *itemInfo) bool {
+	max := self.maxUses.Load()
+	return max > 0 && info.useCount.Load() >= max
 }
 
-// Call this method to clear items with error from the pool.
-//
-// This method is called by user in the implementation of PoolItem.Close() when
-// an error previously set by PoolItem.SetErr() is detected.
-func (self *Pool) ClearItem(item PoolItem) {
-	go self.doClearItem(item)
+// Remove a given item from idle items.
+// If err is nil, the item is marked closed as being cleared, otherwise it is
+// closed with err.
+// Return false if it is not in idle items.
+func (self *Pool) removeIdle(info *itemInfo, err error) bool {
+	for _, shard := range self.shards {
+		shard.mu.Lock()
+		for i, idle := range shard.items {
+			if idle == info {
+				shard.items = append(shard.items[:i], shard.items[i+1:]...)
+				if nil == err {
+					info.setState(StateClosed)
+				} else {
+					self.closeItem(info, err)
+				}
+				shard.mu.Unlock()
+				self.numIdle.Add(-1)
+				return true
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return false
 }
 
-func (self *Pool) doClearItem(_item PoolItem) {
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Printf("panic:%v, pool-name:%v\n", e, self.name)
-		}
-	}()
-	container := _item.GetContainer()
-	if item, ok := container.(*itemInfo); ok && item != nil {
-		if item.closed {
-			return
-		}
-		item.closed = true
-		<-self.chanTotal
-		err := item.item.GetErr()
-		item.item.SetContainer(nil)
-		if err != ErrPoolClosed && err != ErrIdleFull && err != ErrIdleTimeout {
-			fmt.Printf("clearItem with error to new:%v, pool-name:%v\n", err, self.name)
-			select {
-			case self.chanToNew <- struct{}{}:
-			default:
+// Remove the least recently returned idle item and close it with err.
+// Return false if there is no idle item.
+func (self *Pool) evictOldestIdle(err error) bool {
+	var oldest *idleShard
+	var oldestTime int64
+	for _, shard := range self.shards {
+		shard.mu.Lock()
+		if len(shard.items) > 0 {
+			if t := shard.items[0].idleTime.Load(); nil == oldest || t < oldestTime {
+				oldest = shard
+				oldestTime = t
 			}
 		}
+		shard.mu.Unlock()
+	}
+	if nil == oldest {
+		return false
+	}
+	oldest.mu.Lock()
+	if 0 == len(oldest.items) {
+		oldest.mu.Unlock()
+		return false
 	}
+	info := oldest.items[0]
+	oldest.items = append(oldest.items[:0], oldest.items[1:]...)
+	self.closeItem(info, err)
+	oldest.mu.Unlock()
+	self.numIdle.Add(-1)
+	return true
 }
 
-// Check whether an item is active or not.
-func (self *Pool) IsItemActive(_item PoolItem) bool {
-	container := _item.GetContainer()
-	if item, ok := container.(*itemInfo); ok && item != nil {
-		return item.active
+// Remove all idle items and close them with err.
+func (self *Pool) drainIdle(err error) {
+	for _, shard := range self.shards {
+		shard.mu.Lock()
+		items := shard.items
+		shard.items = nil
+		for _, info := range items {
+			self.closeItem(info, err)
+		}
+		shard.mu.Unlock()
+		self.numIdle.Add(-int64(len(items)))
 	}
-	return false
 }
 
-// Call this method to give normal(non-error) items back to the pool after finishing using.
-//
-// This method is called by user in the implementation of PoolItem.Close() when
-// no error with item is detected.
-//
-// If idle items are full, this item will be closed with error ErrIdleFull.
-func (self *Pool) GiveBack(item PoolItem) {
-	go self.doGiveBack(item)
+// Hand an item to the first waiting Get(), or put it into idle items.
+// Return false if there is no waiter and idle items are full.
+func (self *Pool) putLocked(info *itemInfo) bool {
+	if e := self.waiters.Front(); e != nil && !self.paused.Load() {
+		self.waiters.Remove(e)
+		self.numWaiters.Add(-1)
+		info.borrow()
+		e.Value.(chan *itemInfo) <- info
+		return true
+	}
+	return self.pushIdle(info)
 }
 
-var unit uint64 = 0
-var unitCount uint64 = 0
-
-func (self *Pool) doGiveBack(_item PoolItem) {
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Printf("panic:%v, pool-name:%v\n", e, self.name)
-		}
-	}()
-	container := _item.GetContainer()
-	item, ok := container.(*itemInfo)
-	if !ok || nil == item {
-		fmt.Printf("invalid poolItem, pool-name:%v\n", self.name)
+// Hand idle items to waiting Get() calls, which may miss items put into idle
+// items by the lock-free path of GiveBack().
+func (self *Pool) dispatchLocked() {
+	if self.closed.Load() {
+		self.drainIdle(ErrPoolClosed)
 		return
 	}
-	if item.closed {
+	if self.paused.Load() {
 		return
 	}
-	item.active = false
-	item.idleTime = time.Now().Unix()
-	item.timer.Reset(time.Duration(10) * time.Second)
-	select {
-	case self.chanIdle <- item: //may send on closed channel
-		if !item.timer.Stop() {
-			<-item.timer.C
+	for self.waiters.Len() > 0 {
+		info := self.popValidIdle(true)
+		if nil == info {
+			return
 		}
-	case <-item.timer.C:
-		self.closeItem(item, ErrIdleFull)
+		e := self.waiters.Front()
+		self.waiters.Remove(e)
+		self.numWaiters.Add(-1)
+		e.Value.(chan *itemInfo) <- info
+	}
+}
+
+// Like signalRoomLocked(), taking Pool.mu unless locked.
+func (self *Pool) signalRoom(locked bool) {
+	if self.roomWaiters.Load() <= 0 {
 		return
 	}
-	unit++
-	if unit >= 200 {
-		unit = 0
-		unitCount++
-		fmt.Printf("doGiveBack unitCount:%v, pool-name:%v\n", unitCount, self.name)
+	if locked {
+		self.signalRoomLocked()
+		return
 	}
+	self.mu.Lock()
+	self.signalRoomLocked()
+	self.mu.Unlock()
 }
 
-// Close the pool.
-func (self *Pool) Close() {
-	fmt.Printf("Close Pool, pool-name:%v\n", self.name)
-	select {
-	case <-self.chanClose:
+// Wake up GiveBack() calls waiting for room in idle items.
+func (self *Pool) signalRoomLocked() {
+	if self.roomWaiters.Load() > 0 {
+		close(self.chanRoom)
+		self.chanRoom = make(chan struct{})
+		self.roomWaiters.Store(0)
+	}
+}
+
+func (self *Pool) isIdleTimeout(info *itemInfo) bool {
+	if self.idleTimeout <= 0 {
+		return false
+	}
+	idle := time.Duration(self.getClock().Now().UnixNano() - info.idleTime.Load())
+	return idle >= time.Duration(self.idleTimeout)*time.Second
+}
+
+func (self *Pool) checkIdle() {
+	if self.idleTimeout <= 0 {
 		return
+	}
+	var cursor evictCursor // where the next run starts from
+	for {
+		self.mu.Lock()
+		interval := self.evictInterval
+		self.mu.Unlock()
+		if interval <= 0 {
+			interval = time.Duration(min(self.idleTimeout, 10)) * time.Second
+		}
+		timer := self.getClock().NewTimer(interval)
+		select {
+		case <-self.chanClose:
+			timer.Stop()
+			return
+		case <-self.chanConfig:
+			timer.Stop()
+			continue
+		case <-timer.C():
+		}
+		cursor = self.evictIdle(cursor)
+	}
+}
+
+// Where a check for idle timeout limited by evictScanNum stopped.
+type evictCursor struct {
+	shard  int
+	offset int // index in the idle items of the shard
+}
+
+// Close idle timeout items in one pass over idle items from cursor, scanning
+// at most evictScanNum items if it is positive, and keeping at least minIdle
+// idle items. Return the cursor to start the next run from.
+func (self *Pool) evictIdle(cursor evictCursor) evictCursor {
+	begin := self.getClock().Now()
+	self.mu.Lock()
+	scanNum := self.evictScanNum
+	minIdle := int64(self.minIdle)
+	self.mu.Unlock()
+	scanned := 0
+	removed := 0
+	stopped := false
+	for i := 0; i < len(self.shards) && !stopped; i++ {
+		shard := self.shards[cursor.shard]
+		shard.mu.Lock()
+		// items are roughly in the order of being returned, so the oldest ones
+		// are scanned first.
+		offset := min(cursor.offset, len(shard.items))
+		n := 0
+		kept := shard.items[:offset]
+		j := offset
+		for ; j < len(shard.items); j++ {
+			if scanNum > 0 && scanned >= scanNum {
+				stopped = true
+				break
+			}
+			scanned++
+			info := shard.items[j]
+			if self.numIdle.Load()-int64(n) > minIdle && self.isIdleTimeout(info) {
+				self.closeItem(info, ErrIdleTimeout)
+				n++
+				continue
+			}
+			kept = append(kept, info)
+		}
+		if stopped {
+			cursor.offset = len(kept)
+		}
+		kept = append(kept, shard.items[j:]...)
+		clear(shard.items[len(kept):])
+		shard.items = kept
+		shard.mu.Unlock()
+		self.numIdle.Add(-int64(n))
+		removed += n
+		if !stopped {
+			cursor = evictCursor{shard: (cursor.shard + 1) % len(self.shards)}
+		}
+	}
+	if removed > 0 {
+		self.signalRoom(false)
+	}
+	self.stats.evictRun.Add(1)
+	self.stats.evictRunNanos.Store(int64(self.getClock().Now().Sub(begin)))
+	self.stats.evictRunClosed.Store(uint64(removed))
+	return cursor
+}
+
+// Set the source of time, default the one of package time.
+//
+// This method can be called after NewPool(), but it should be called before
+// the first Get() since times already recorded are not converted.
+func (self *Pool) SetClock(clock Clock) {
+	self.clock.Store(&clock)
+	self.notifyConfig()
+}
+
+func (self *Pool) getClock() Clock {
+	return *self.clock.Load()
+}
+
+// Wake up checkIdle() to apply changed settings.
+func (self *Pool) notifyConfig() {
+	select {
+	case self.chanConfig <- struct{}{}:
 	default:
 	}
+}
 
-	close(self.chanToNew)
-	close(self.chanTotal)
-	close(self.chanClose)
-	close(self.chanIdle)
-	for item := range self.chanIdle {
-		self.closeItem(item, ErrPoolClosed)
+// Set callbacks invoked on item lifecycle events.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetHooks(hooks Hooks) {
+	self.hooks.Store(&hooks)
+}
+
+// Set Get()'s timeout in second, 0 means no timeout, default 0.
+// Get() will return with error ErrGetTimeout on timeout.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetGetTimeout(timeout int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.getTimeout = timeout
+}
+
+// Set what GiveBack() does when idle items are full, default IdleFullWait
+// with wait 10 seconds.
+//
+// wait is only used by IdleFullWait, the maximum time to wait for room in idle
+// items; wait <= 0 makes IdleFullWait the same as IdleFullClose.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetIdleFullPolicy(policy IdleFullPolicy, wait time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.idleFullPolicy = policy
+	self.idleFullWait = wait
+}
+
+// Set the timeout of creating an item, 0 means no timeout, default 0.
+//
+// It only works with a Creator implementing ContextCreator, whose context
+// passed to NewItemContext() is cancelled on timeout. For other Creators,
+// WithCreateTimeout() can be used instead.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetCreateTimeout(timeout time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.createTimeout = timeout
+}
+
+// Set the maximum number of items being created by Creator.NewItem() at the
+// same time, 0 means no limit, default 0.
+// Demand beyond the limit is queued until ongoing creations finish, so that a
+// traffic spike does not hit a cold backend with a connection storm.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetMaxConnecting(n int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.maxConnecting = n
+	self.maybeCreateLocked()
+}
+
+// Limit item creations to rate per second on average with bursts of up to
+// burst creations, rate <= 0 means no limit, default no limit.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetCreateRate(rate float64, burst int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.createLimiter.set(rate, burst, self.getClock().Now())
+	self.maybeCreateLocked()
+}
+
+// Set the maximum number of Get() calls waiting for an item, 0 means no limit,
+// default 0. Once the limit is reached, Get() fails immediately with
+// ErrTooManyWaiters instead of waiting, so that load can be shed early.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetMaxWaiters(n int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.maxWaiters = n
+}
+
+// Set whether Get() waits for Resume() when the pool is paused, default false.
+//
+// If wait is false, Get() returns with error ErrPoolPaused during the pause,
+// otherwise it waits as if no item is available, subject to SetGetTimeout().
+//
+// This method can be called after NewPool().
+func (self *Pool) SetPauseWait(wait bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.pauseWait.Store(wait)
+	if !wait && self.paused.Load() {
+		self.failWaitersLocked()
 	}
-	self.creator.Close()
 }
 
-// Pool closed or not.
-func (self *Pool) Closed() bool {
+// Set the interval of checking idle items for idle timeout, 0 means the default
+// of min(idleTimeout, 10) seconds.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetEvictInterval(interval time.Duration) {
+	self.mu.Lock()
+	self.evictInterval = interval
+	self.mu.Unlock()
+	self.notifyConfig()
+}
+
+// Set the maximum number of idle items scanned by one check for idle timeout,
+// 0 means all, default 0. The next check continues from where the last one
+// stopped.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetEvictScanNum(n int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.evictScanNum = n
+}
+
+// Set the number of idle items kept by the check for idle timeout, default 0.
+// Items kept this way are still closed by Get() when found idle timeout.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetMinIdle(n int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.minIdle = n
+}
+
+// Set the maximum number of uses of an item, 0 means no limit, default 0.
+//
+// An item which has been returned by Get() n times is closed with error
+// ErrMaxUses when given back, and a replacement is created as for items
+// cleared with errors. Items are also checked by Get() in case n is lowered.
+//
+// This method can be called after NewPool().
+func (self *Pool) SetMaxUses(n uint64) {
+	self.maxUses.Store(n)
+}
+
+// Get pooled item originally created by Creator.NewItem().
+//
+// If SetGetTimeout() is called with non-zero value, Get() will return with
+// error ErrGetTimeout after timeout.
+//
+// If SetMaxWaiters() is called with non-zero value, Get() will return with
+// error ErrTooManyWaiters when too many Get() calls are waiting.
+//
+// If the pool is paused by Pause(), Get() will return with error ErrPoolPaused,
+// or wait for Resume() if SetPauseWait() is called with true.
+func (self *Pool) Get() (PoolItem, error) {
+	start := self.getClock().Now()
+	var deadline time.Time
+	for {
+		info, err := self.getItem(&deadline)
+		if err != nil {
+			return nil, self.wrapErr("get", nil, err)
+		}
+		if self.initItem(info, start) {
+			return info.item, nil
+		}
+	}
+}
+
+// Get an idle item without waiting.
+//
+// It returns (item, true) only if an idle item passes idle timeout check and
+// Creator.InitItem() right now, otherwise (nil, false), which is also the case
+// when the pool is paused.
+//
+// If create is true and no idle item is available, one item is created in
+// background for later calls, as long as the settings of the pool permit, but
+// TryGet() does not wait for it.
+func (self *Pool) TryGet(create bool) (PoolItem, bool) {
+	start := self.getClock().Now()
+	for !self.closed.Load() && !self.paused.Load() {
+		info := self.popValidIdle(false)
+		if nil == info {
+			if create {
+				self.mu.Lock()
+				self.maybeCreateLocked()
+				self.mu.Unlock()
+			}
+			return nil, false
+		}
+		if self.initItem(info, start) {
+			return info.item, true
+		}
+	}
+	return nil, false
+}
+
+// Take an item in validating state from idle items, or wait for one.
+// deadline is set on the first wait and shared by the retries of one Get(),
+// which happen when Creator.InitItem() fails.
+func (self *Pool) getItem(deadline *time.Time) (*itemInfo, error) {
+	if self.closed.Load() {
+		return nil, ErrPoolClosed
+	}
+	if self.paused.Load() {
+		if !self.pauseWait.Load() {
+			return nil, ErrPoolPaused
+		}
+	} else if info := self.popValidIdle(false); info != nil {
+		if self.numIdle.Load() == 0 {
+			self.mu.Lock()
+			self.maybeCreateLocked()
+			self.mu.Unlock()
+		}
+		return info, nil
+	}
+
+	self.mu.Lock()
+	if self.closed.Load() {
+		self.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	paused := self.paused.Load()
+	if paused && !self.pauseWait.Load() {
+		self.mu.Unlock()
+		return nil, ErrPoolPaused
+	}
+	if self.maxWaiters > 0 && self.waiters.Len() >= self.maxWaiters {
+		self.mu.Unlock()
+		self.stats.tooManyWaiters.Add(1)
+		return nil, ErrTooManyWaiters
+	}
+	req := make(chan *itemInfo, 1)
+	elem := self.waiters.PushBack(req)
+	self.numWaiters.Add(1)
+	// check again after being seen as a waiter by the lock-free GiveBack(),
+	// or wait for Resume() if paused
+	if !paused {
+		if info := self.popValidIdle(true); info != nil {
+			self.waiters.Remove(elem)
+			self.numWaiters.Add(-1)
+			self.maybeCreateLocked()
+			self.mu.Unlock()
+			return info, nil
+		}
+	}
+	self.maybeCreateLocked()
+	getTimeout := self.getTimeout
+	self.mu.Unlock()
+	defer self.addWait(self.getClock().Now())
+
+	if getTimeout <= 0 {
+		info, ok := <-req
+		return waitResult(info, ok)
+	}
+	now := self.getClock().Now()
+	if deadline.IsZero() {
+		*deadline = now.Add(time.Duration(getTimeout) * time.Second)
+	}
+	if remaining := deadline.Sub(now); remaining > 0 {
+		timer := self.getClock().NewTimer(remaining)
+		select {
+		case info, ok := <-req:
+			timer.Stop()
+			return waitResult(info, ok)
+		case <-timer.C():
+		}
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	select {
-	case <-self.chanClose:
-		return true
+	case info, ok := <-req: // handed over, failed or closed before the lock
+		return waitResult(info, ok)
 	default:
+		self.waiters.Remove(elem)
+		self.numWaiters.Add(-1)
+		return nil, ErrGetTimeout
+	}
+}
+
+// Result of a waiter of Get(): the channel is closed by Close(), and nil is
+// sent by Pause().
+func waitResult(info *itemInfo, ok bool) (*itemInfo, error) {
+	if !ok {
+		return nil, ErrPoolClosed
+	}
+	if nil == info {
+		return nil, ErrPoolPaused
+	}
+	return info, nil
+}
+
+// Count a wait of Get() started at start.
+func (self *Pool) addWait(start time.Time) {
+	self.stats.wait.Add(1)
+	self.stats.waitNanos.Add(int64(self.getClock().Now().Sub(start)))
+}
+
+// Call Creator.InitItem() on an item in validating state.
+// Return false if the item is closed instead of being borrowed.
+func (self *Pool) initItem(info *itemInfo, start time.Time) bool {
+	n := info.useCount.Load() + 1
+	if err := initItemContext(self.ctx, info.creator.Creator, info.item, n); err != nil {
+		fmt.Printf("InitItem error, item:%p, pool-name:%v, err:%v\n", info, self.name, err)
+		self.stats.initFailed.Add(1)
+		self.closeItem(info, err)
 		return false
 	}
+	if !info.casState(StateValidating, StateBorrowed) {
+		// cleared during InitItem()
+		return false
+	}
+	// count the use only once the item passes validation
+	info.useCount.Add(1)
+	info.lastBorrowed.Store(self.getClock().Now().UnixNano())
+	if hooks := self.hooks.Load(); hooks.OnBorrow != nil {
+		hooks.OnBorrow(info.item, self.getClock().Now().Sub(start), n)
+	}
+	return true
+}
+
+// Close an item with err as the reason.
+// The item is expected to call ClearItem() in its Close().
+func (self *Pool) closeItem(info *itemInfo, err error) {
+	for {
+		state := info.getState()
+		if state == StateClosing || state == StateClosed {
+			return
+		}
+		if info.casState(state, StateClosing) {
+			break
+		}
+	}
+	err = self.wrapErr("close", info, err)
+	info.setErr(err)
+	self.stats.closed.Add(1)
+	switch {
+	case errors.Is(err, ErrIdleTimeout):
+		self.stats.idleTimeout.Add(1)
+	case errors.Is(err, ErrPoolClosed):
+		self.stats.poolClosed.Add(1)
+	case errors.Is(err, ErrInvalidated):
+		self.stats.invalidated.Add(1)
+	}
+	hooks := self.hooks.Load()
+	go func() {
+		if hooks.OnClose != nil {
+			hooks.OnClose(info.item, err)
+		}
+		info.item.SetErr(err)
+		info.item.Close()
+	}()
+}
+
+// Return the bookkeeping of an item created by this pool, or nil.
+func (self *Pool) getInfo(item PoolItem) *itemInfo {
+	if nil == item {
+		return nil
+	}
+	info, ok := item.GetContainer().(*itemInfo)
+	if !ok || nil == info || info.pool != self {
+		return nil
+	}
+	return info
+}
+
+// Call this method to clear items with error from the pool.
+//
+// This method is called by user in the implementation of PoolItem.Close() when
+// an error previously set by PoolItem.SetErr() is detected.
+func (self *Pool) ClearItem(item PoolItem) {
+	go func() {
+		if err := self.clearItem(item); err != nil {
+			fmt.Printf("clearItem error:%v, pool-name:%v\n", err, self.name)
+		}
+	}()
+}
+
+// Synchronous version of ClearItem().
+// The item is removed from the pool when this method returns.
+//
+// It returns ErrInvalidItem if item is not from this pool.
+// Since item.GetErr() is called, it must not be called with a lock held which
+// item.GetErr() needs.
+func (self *Pool) ClearItemSync(item PoolItem) error {
+	return self.wrapErr("clear", self.getInfo(item), self.clearItem(item))
+}
+
+func (self *Pool) clearItem(_item PoolItem) error {
+	info := self.getInfo(_item)
+	if nil == info {
+		return ErrInvalidItem
+	}
+	err := _item.GetErr()
+	for {
+		state := info.getState()
+		if state == StateClosed {
+			return nil
+		}
+		if state == StateIdle {
+			if self.removeIdle(info, nil) {
+				break
+			}
+			continue
+		}
+		if info.casState(state, StateClosed) {
+			if state != StateClosing {
+				self.stats.cleared.Add(1)
+			}
+			break
+		}
+	}
+	if err != nil {
+		info.setErr(err)
+	}
+	self.mu.Lock()
+	self.numTotal--
+	delete(self.items, info)
+	release := self.releaseCreatorLocked(info.creator)
+	evicted := info.evicted.Load() != nil
+	if !evicted && !errors.Is(err, ErrPoolClosed) && !errors.Is(err, ErrIdleFull) &&
+		!errors.Is(err, ErrIdleTimeout) && !errors.Is(err, ErrPoolPaused) {
+		fmt.Printf("clearItem with error to new:%v, pool-name:%v\n", err, self.name)
+		self.maybeCreateLocked()
+	} else if self.waiters.Len() > 0 {
+		self.maybeCreateLocked()
+	}
+	self.mu.Unlock()
+	if release {
+		info.creator.Close()
+	}
+	_item.SetContainer(nil)
+	if hooks := self.hooks.Load(); hooks.OnDiscard != nil {
+		hooks.OnDiscard(_item, err)
+	}
+	return nil
+}
+
+// Evict an item from the pool with reason, or ErrEvicted if reason is nil.
+//
+// Unlike PoolItem.SetErr(), this is for items which are fine but should not be
+// reused. An idle item is closed with reason immediately, and a borrowed one
+// is closed with reason when given back, where GiveBackSync() returns reason.
+// Evicted items are not regarded as failures of the backend, so no
+// replacement is created for them unless Get() calls are waiting.
+//
+// It returns ErrInvalidItem if item is not from this pool.
+func (self *Pool) Evict(item PoolItem, reason error) error {
+	info := self.getInfo(item)
+	if nil == info {
+		return self.wrapErr("evict", nil, ErrInvalidItem)
+	}
+	if nil == reason {
+		reason = ErrEvicted
+	}
+	if !info.evicted.CompareAndSwap(nil, &reason) {
+		return nil
+	}
+	self.stats.evicted.Add(1)
+	// a lock-free GiveBack() may have pushed the item before it is marked
+	self.closeEvictedIdle(info)
+	return nil
+}
+
+// Close the item if it is evicted and idle.
+func (self *Pool) closeEvictedIdle(info *itemInfo) {
+	if reason := info.evicted.Load(); reason != nil && info.getState() == StateIdle {
+		self.removeIdle(info, *reason)
+	}
+}
+
+// Get a snapshot of the bookkeeping of an item.
+// Return false if item is not from this pool or has been cleared.
+//
+// It can be called in Creator.InitItem() too.
+func (self *Pool) ItemInfo(item PoolItem) (ItemInfo, bool) {
+	info := self.getInfo(item)
+	if nil == info {
+		return ItemInfo{}, false
+	}
+	self.mu.Lock()
+	_, ok := self.items[info]
+	self.mu.Unlock()
+	if !ok {
+		return ItemInfo{}, false
+	}
+	return info.snapshot(), true
+}
+
+// Get snapshots of the bookkeeping of all items not cleared yet, including
+// items being closed, in order of ID.
+func (self *Pool) Snapshot() []ItemInfo {
+	self.mu.Lock()
+	infos := make([]ItemInfo, 0, len(self.items))
+	for info := range self.items {
+		infos = append(infos, info.snapshot())
+	}
+	self.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Check whether an item is active or not.
+func (self *Pool) IsItemActive(_item PoolItem) bool {
+	info := self.getInfo(_item)
+	if nil == info {
+		return false
+	}
+	state := info.getState()
+	return state == StateBorrowed || state == StateValidating
+}
+
+// Call this method to give normal(non-error) items back to the pool after finishing using.
+//
+// This method is called by user in the implementation of PoolItem.Close() when
+// no error with item is detected.
+//
+// If idle items are full, what to do depends on SetIdleFullPolicy(), by
+// default this item will be closed with error ErrIdleFull after waiting 10
+// seconds for room in idle items.
+//
+// If the Creator implements Resetter, ResetItem() is called before the item
+// is put back to idle items.
+func (self *Pool) GiveBack(item PoolItem) {
+	if self.sharded {
+		if info := self.getInfo(item); info != nil {
+			if self.resetItem(info) != nil {
+				return
+			}
+			if self.giveBackFast(info) {
+				if hooks := self.hooks.Load(); hooks.OnReturn != nil {
+					hooks.OnReturn(item)
+				}
+				return
+			}
+			go self.giveBackInfo(info)
+			return
+		}
+	}
+	go func() {
+		if err := self.giveBack(item); errors.Is(err, ErrInvalidItem) {
+			fmt.Printf("invalid poolItem, pool-name:%v\n", self.name)
+		}
+	}()
+}
+
+// Synchronous version of GiveBack().
+// The item is in idle items, handed to a waiting Get() or closed when this
+// method returns, so it may block while waiting for room in idle items with
+// policy IdleFullWait.
+//
+// It returns nil if the item is given back, or one of the errors below:
+//
+// ErrInvalidItem if item is not from this pool;
+//
+// ErrNotBorrowed if item is already given back or cleared;
+//
+// ErrPoolClosed, ErrMaxUses, ErrIdleFull, ErrInvalidated, the reason of
+// Evict() or the error of Resetter.ResetItem() if the item is closed with this
+// error.
+func (self *Pool) GiveBackSync(item PoolItem) error {
+	info := self.getInfo(item)
+	return self.wrapErr("giveback", info, self.giveBack(item))
+}
+
+// Put a borrowed item into idle items without taking Pool.mu when no Get() is
+// waiting. Return false if the slow path is needed.
+func (self *Pool) giveBackFast(info *itemInfo) bool {
+	if info.getState() != StateBorrowed || self.numWaiters.Load() > 0 || self.discardReason(info) != nil {
+		return false
+	}
+	now := self.getClock().Now().UnixNano()
+	info.idleTime.Store(now)
+	info.lastReturned.Store(now)
+	if !self.pushIdle(info) {
+		return false
+	}
+	// an Evict() or Invalidate() may have missed the item just pushed
+	self.closeEvictedIdle(info)
+	if self.isInvalidated(info) {
+		self.removeIdle(info, ErrInvalidated)
+	}
+	// a Get() or Close() may have missed the item just pushed
+	if self.numWaiters.Load() > 0 || self.closed.Load() {
+		self.mu.Lock()
+		self.dispatchLocked()
+		self.mu.Unlock()
+	}
+	return true
+}
+
+func (self *Pool) giveBack(_item PoolItem) error {
+	info := self.getInfo(_item)
+	if nil == info {
+		return ErrInvalidItem
+	}
+	if err := self.resetItem(info); err != nil {
+		return err
+	}
+	return self.giveBackInfo(info)
+}
+
+// Give back an item which has been reset.
+func (self *Pool) giveBackInfo(info *itemInfo) error {
+	self.mu.Lock()
+	err := self.giveBackLocked(info)
+	self.mu.Unlock()
+	if hooks := self.hooks.Load(); nil == err && hooks.OnReturn != nil {
+		hooks.OnReturn(info.item)
+	}
+	return err
+}
+
+// Call Resetter.ResetItem() on a borrowed item being given back, and close the
+// item with the error if it fails. Items to be closed by giveBackLocked()
+// instead of being reused are not reset.
+func (self *Pool) resetItem(info *itemInfo) error {
+	if info.getState() != StateBorrowed || self.discardReason(info) != nil {
+		return nil
+	}
+	err := resetItem(info.creator.Creator, info.item)
+	if err != nil {
+		fmt.Printf("ResetItem error, item:%p, pool-name:%v, err:%v\n", info, self.name, err)
+		self.stats.resetFailed.Add(1)
+		self.closeItem(info, err)
+	}
+	return err
+}
+
+// Return why a borrowed item being given back is to be closed instead of
+// reused, or nil.
+func (self *Pool) discardReason(info *itemInfo) error {
+	switch {
+	case self.closed.Load():
+		return ErrPoolClosed
+	case self.isMaxUses(info):
+		return ErrMaxUses
+	case self.isInvalidated(info):
+		return ErrInvalidated
+	}
+	if reason := info.evicted.Load(); reason != nil {
+		return *reason
+	}
+	return nil
+}
+
+// Put a borrowed item back, handling full idle items by idleFullPolicy.
+// Return the error the item is closed with instead.
+func (self *Pool) giveBackLocked(info *itemInfo) error {
+	var timer Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	full := false
+	for {
+		if info.getState() != StateBorrowed {
+			return ErrNotBorrowed
+		}
+		if err := self.discardReason(info); err != nil {
+			if errors.Is(err, ErrMaxUses) {
+				self.stats.maxUsesClosed.Add(1)
+			}
+			self.closeItem(info, err)
+			return err
+		}
+		now := self.getClock().Now().UnixNano()
+		info.idleTime.Store(now)
+		info.lastReturned.Store(now)
+		if self.putLocked(info) {
+			if timer != nil {
+				self.stats.idleFullWaited.Add(1)
+			}
+			return nil
+		}
+		if !full {
+			full = true
+			self.stats.idleFull.Add(1)
+		}
+		switch {
+		case self.idleFullPolicy == IdleFullEvictOldest:
+			if self.evictOldestIdle(ErrIdleFull) {
+				self.stats.idleFullEvicted.Add(1)
+				continue
+			}
+		case self.idleFullPolicy == IdleFullWait && self.idleFullWait > 0:
+			self.roomWaiters.Add(1)
+			room := self.chanRoom
+			// check again after being seen as a room waiter by popIdle()
+			if self.pushIdle(info) {
+				if timer != nil {
+					self.stats.idleFullWaited.Add(1)
+				}
+				return nil
+			}
+			if nil == timer {
+				timer = self.getClock().NewTimer(self.idleFullWait)
+			}
+			self.mu.Unlock()
+			select {
+			case <-room:
+				self.mu.Lock()
+				continue
+			case <-timer.C():
+				self.mu.Lock()
+			}
+		}
+		self.stats.idleFullClosed.Add(1)
+		self.closeItem(info, ErrIdleFull)
+		return ErrIdleFull
+	}
+}
+
+// Pause the pool, e.g. during backend maintenance, without closing it.
+//
+// While paused, Get() returns with error ErrPoolPaused or waits for Resume(),
+// see SetPauseWait(), and no item is created. Items can still be given back.
+// If closeIdle is true, idle items are closed with error ErrPoolPaused.
+//
+// The reason is shown in Stats() until Resume().
+func (self *Pool) Pause(reason string, closeIdle bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.closed.Load() {
+		return
+	}
+	fmt.Printf("Pause Pool, pool-name:%v, reason:%v\n", self.name, reason)
+	self.paused.Store(true)
+	self.pauseReason = reason
+	if !self.pauseWait.Load() {
+		self.failWaitersLocked()
+	}
+	if closeIdle {
+		self.drainIdle(ErrPoolPaused)
+	}
+}
+
+// Resume the pool paused by Pause().
+// Items are created again, and Get() calls waiting during the pause are served.
+func (self *Pool) Resume() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if !self.paused.Load() {
+		return
+	}
+	fmt.Printf("Resume Pool, pool-name:%v\n", self.name)
+	self.paused.Store(false)
+	self.pauseReason = ""
+	self.dispatchLocked()
+	self.maybeCreateLocked()
+}
+
+// Invalidate all items of the pool, e.g. after a backend failover or credential
+// rotation, without closing the pool.
+//
+// Idle items are closed with error ErrInvalidated immediately, and borrowed
+// items are closed with the same error instead of being reused when given
+// back. Items being created are also discarded, so Get() after Invalidate()
+// only returns items created afterwards.
+func (self *Pool) Invalidate() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.closed.Load() {
+		return
+	}
+	self.invalidateLocked()
+}
+
+func (self *Pool) invalidateLocked() {
+	generation := self.generation.Add(1)
+	fmt.Printf("Invalidate Pool, pool-name:%v, generation:%v\n", self.name, generation)
+	self.drainIdle(ErrInvalidated)
+}
+
+// Replace the Creator of the pool, e.g. when the backend address changes.
+//
+// Items are created by the new creator afterwards, while Creator.InitItem() of
+// existing items is still called on the creator which created them.
+// If invalidate is true, existing items are invalidated as by Invalidate().
+// Creator.Close() of the old creator is called once its last item is cleared.
+//
+// It returns ErrPoolClosed without using creator if the pool is closed.
+func (self *Pool) SetCreator(creator Creator, invalidate bool) error {
+	self.mu.Lock()
+	if self.closed.Load() {
+		self.mu.Unlock()
+		return self.wrapErr("setcreator", nil, ErrPoolClosed)
+	}
+	fmt.Printf("SetCreator, pool-name:%v, invalidate:%v\n", self.name, invalidate)
+	old := self.creator
+	old.replaced = true
+	self.creator = &poolCreator{Creator: creator}
+	if invalidate {
+		self.invalidateLocked()
+	}
+	release := 0 == old.numItems
+	self.mu.Unlock()
+	if release {
+		old.Close()
+	}
+	return nil
+}
+
+// Count an item of creator as cleared or failed to be created.
+// Return true if creator should be closed as replaced and no item is left.
+func (self *Pool) releaseCreatorLocked(creator *poolCreator) bool {
+	creator.numItems--
+	return creator.replaced && 0 == creator.numItems
+}
+
+// Make waiting Get() calls return with error ErrPoolPaused.
+func (self *Pool) failWaitersLocked() {
+	for e := self.waiters.Front(); e != nil; e = e.Next() {
+		e.Value.(chan *itemInfo) <- nil
+	}
+	self.waiters.Init()
+	self.numWaiters.Store(0)
+}
+
+// Close the pool.
+func (self *Pool) Close() {
+	fmt.Printf("Close Pool, pool-name:%v\n", self.name)
+	self.mu.Lock()
+	if self.closed.Load() {
+		self.mu.Unlock()
+		return
+	}
+	self.closed.Store(true)
+	close(self.chanClose)
+	self.drainIdle(ErrPoolClosed)
+	for e := self.waiters.Front(); e != nil; e = e.Next() {
+		close(e.Value.(chan *itemInfo))
+	}
+	self.waiters.Init()
+	self.numWaiters.Store(0)
+	self.signalRoomLocked()
+	creator := self.creator
+	self.mu.Unlock()
+	self.Unregister()
+	self.cancel()
+	creator.Close()
+}
+
+// Pool closed or not.
+func (self *Pool) Closed() bool {
+	return self.closed.Load()
 }
 
 // Get the total number of all items including active and idle.
 func (self *Pool) GetTotalNum() int {
-	return len(self.chanTotal)
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.numTotal
 }
 
 // Get the number of idle items.
 func (self *Pool) GetIdleNum() int {
-	return len(self.chanIdle)
+	return int(self.numIdle.Load())
+}
+
+// Get settings of the pool.
+func (self *Pool) Config() Config {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return Config{
+		Name:           self.name,
+		MaxTotalNum:    self.maxTotalNum,
+		MaxIdleNum:     self.maxIdleNum,
+		IdleTimeout:    self.idleTimeout,
+		ShardNum:       len(self.shards),
+		GetTimeout:     self.getTimeout,
+		IdleFullPolicy: self.idleFullPolicy,
+		IdleFullWait:   self.idleFullWait,
+		CreateTimeout:  self.createTimeout,
+		MaxConnecting:  self.maxConnecting,
+		CreateRate:     self.createLimiter.rate,
+		CreateBurst:    int(self.createLimiter.burst),
+		MaxWaiters:     self.maxWaiters,
+		MaxUses:        self.maxUses.Load(),
+		PauseWait:      self.pauseWait.Load(),
+		EvictInterval:  self.evictInterval,
+		EvictScanNum:   self.evictScanNum,
+		MinIdle:        self.minIdle,
+	}
+}
+
+// Get statistics of the pool.
+func (self *Pool) Stats() Stats {
+	self.mu.Lock()
+	total := self.numTotal
+	creating := self.numCreating
+	waiters := self.waiters.Len()
+	paused := self.paused.Load()
+	pauseReason := self.pauseReason
+	self.mu.Unlock()
+	return Stats{
+		TotalNum:             total,
+		IdleNum:              self.GetIdleNum(),
+		CreatingNum:          creating,
+		WaiterNum:            waiters,
+		Paused:               paused,
+		PauseReason:          pauseReason,
+		Generation:           self.generation.Load(),
+		WaitNum:              self.stats.wait.Load(),
+		WaitDuration:         time.Duration(self.stats.waitNanos.Load()),
+		TooManyWaitersNum:    self.stats.tooManyWaiters.Load(),
+		CreatedNum:           self.stats.created.Load(),
+		CreateFailedNum:      self.stats.createFailed.Load(),
+		ClosedNum:            self.stats.closed.Load(),
+		IdleTimeoutClosedNum: self.stats.idleTimeout.Load(),
+		PoolClosedNum:        self.stats.poolClosed.Load(),
+		InvalidatedNum:       self.stats.invalidated.Load(),
+		EvictedNum:           self.stats.evicted.Load(),
+		InitFailedNum:        self.stats.initFailed.Load(),
+		ResetFailedNum:       self.stats.resetFailed.Load(),
+		ClearedNum:           self.stats.cleared.Load(),
+		MaxUsesClosedNum:     self.stats.maxUsesClosed.Load(),
+		IdleFullNum:          self.stats.idleFull.Load(),
+		IdleFullWaitedNum:    self.stats.idleFullWaited.Load(),
+		IdleFullEvictedNum:   self.stats.idleFullEvicted.Load(),
+		IdleFullClosedNum:    self.stats.idleFullClosed.Load(),
+		EvictRunNum:          self.stats.evictRun.Load(),
+		EvictRunDuration:     time.Duration(self.stats.evictRunNanos.Load()),
+		EvictRunClosedNum:    self.stats.evictRunClosed.Load(),
+	}
 }
 
 // Get the name of pool specified at NewPool()
@@ -0,0 +1,673 @@
+package connpool_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+var (
+	errInit = errors.New("init failed")
+	errDial = errors.New("dial failed")
+	errUse  = errors.New("broken while used")
+)
+
+func newTestPool(t *testing.T, maxTotal int, maxIdle int) (*connpool.Pool, *connpooltest.FakeCreator) {
+	t.Helper()
+	creator := connpooltest.NewFakeCreator()
+	pool := connpool.NewPool(t.Name(), creator, maxTotal, maxIdle, 0)
+	creator.SetPool(pool, true)
+	t.Cleanup(pool.Close)
+	return pool, creator
+}
+
+func mustGet(t *testing.T, pool *connpool.Pool) *connpooltest.FakeItem {
+	t.Helper()
+	item, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return item.(*connpooltest.FakeItem)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(connpooltest.WaitTimeout); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+	}
+}
+
+func TestGetGiveBack(t *testing.T) {
+	pool, creator := newTestPool(t, 2, 2)
+	item := mustGet(t, pool)
+	if !pool.IsItemActive(item) {
+		t.Fatal("item got is not active")
+	}
+	if err := item.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if pool.IsItemActive(item) {
+		t.Fatal("item given back is still active")
+	}
+	if again := mustGet(t, pool); again != item {
+		t.Fatalf("got item %v, want the idle item %v", again.ID(), item.ID())
+	}
+	info, ok := pool.ItemInfo(item)
+	if !ok || info.UseCount != 2 || info.State != connpool.StateBorrowed {
+		t.Fatalf("ItemInfo: %+v, %v", info, ok)
+	}
+	if n := creator.InitItemNum(); n != 2 {
+		t.Fatalf("InitItem called %v times, want 2", n)
+	}
+	item.Close()
+	connpooltest.AssertNoLeaks(t, pool)
+}
+
+func TestGiveBackAsync(t *testing.T) {
+	pool, creator := newTestPool(t, 2, 2)
+	creator.SetPool(pool, false)
+	item := mustGet(t, pool)
+	item.Close()
+	connpooltest.WaitForIdle(t, pool, pool.GetTotalNum())
+	connpooltest.AssertNoLeaks(t, pool)
+}
+
+func TestGiveBackErrors(t *testing.T) {
+	pool, _ := newTestPool(t, 2, 2)
+	other, _ := newTestPool(t, 2, 2)
+	item := mustGet(t, pool)
+	if err := other.GiveBackSync(item); !errors.Is(err, connpool.ErrInvalidItem) {
+		t.Fatalf("GiveBackSync to another pool: %v", err)
+	}
+	if err := pool.GiveBackSync(item); err != nil {
+		t.Fatalf("GiveBackSync: %v", err)
+	}
+	err := pool.GiveBackSync(item)
+	if !errors.Is(err, connpool.ErrNotBorrowed) {
+		t.Fatalf("second GiveBackSync: %v", err)
+	}
+	var poolErr *connpool.PoolError
+	if !errors.As(err, &poolErr) || poolErr.Pool != pool.GetName() || poolErr.Op != "giveback" {
+		t.Fatalf("error %#v is not a PoolError of giveback", err)
+	}
+}
+
+func TestClearItem(t *testing.T) {
+	pool, creator := newTestPool(t, 2, 2)
+	item := mustGet(t, pool)
+	item.SetErr(errUse)
+	if err := item.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !item.Closed() {
+		t.Fatal("item with error is not closed")
+	}
+	if _, ok := pool.ItemInfo(item); ok {
+		t.Fatal("cleared item is still in the pool")
+	}
+	// a replacement is created for the broken item
+	connpooltest.WaitForIdle(t, pool, 1)
+	if n := creator.NewItemNum(); n < 2 {
+		t.Fatalf("NewItem called %v times, want a replacement", n)
+	}
+	if s := pool.Stats(); s.ClearedNum != 1 {
+		t.Fatalf("ClearedNum %v, want 1", s.ClearedNum)
+	}
+	connpooltest.AssertNoLeaks(t, pool)
+}
+
+func TestClose(t *testing.T) {
+	pool, creator := newTestPool(t, 3, 3)
+	idle := mustGet(t, pool)
+	borrowed := mustGet(t, pool)
+	idle.Close()
+	pool.Close()
+	if !pool.Closed() || !creator.Closed() {
+		t.Fatal("pool or creator not closed")
+	}
+	if _, err := pool.Get(); !errors.Is(err, connpool.ErrPoolClosed) {
+		t.Fatalf("Get after Close: %v", err)
+	}
+	if err := borrowed.Close(); !errors.Is(err, connpool.ErrPoolClosed) {
+		t.Fatalf("GiveBack after Close: %v", err)
+	}
+	connpooltest.WaitForTotal(t, pool, 0)
+	for _, item := range creator.Items() {
+		if !item.Closed() {
+			t.Fatalf("item %v not closed", item.ID())
+		}
+	}
+	if calls := idle.SetErrCalls(); len(calls) != 1 || !errors.Is(calls[0], connpool.ErrPoolClosed) {
+		t.Fatalf("idle item got SetErr %v, want ErrPoolClosed", calls)
+	}
+	pool.Close() // no-op
+}
+
+// Hooks of an item are called in the order of its lifecycle events.
+func TestHooks(t *testing.T) {
+	pool, _ := newTestPool(t, 1, 1)
+	var mu sync.Mutex
+	events := make(map[int][]string)
+	var closeReason error
+	record := func(item connpool.PoolItem, event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := item.(*connpooltest.FakeItem).ID()
+		events[id] = append(events[id], event)
+	}
+	pool.SetHooks(connpool.Hooks{
+		OnCreate: func(item connpool.PoolItem) { record(item, "create") },
+		OnBorrow: func(item connpool.PoolItem, wait time.Duration, useCount uint64) {
+			record(item, fmt.Sprintf("borrow %v", useCount))
+		},
+		OnReturn: func(item connpool.PoolItem) { record(item, "return") },
+		OnDiscard: func(item connpool.PoolItem, err error) {
+			record(item, fmt.Sprintf("discard %v", errors.Is(err, errUse)))
+		},
+		OnClose: func(item connpool.PoolItem, reason error) {
+			mu.Lock()
+			closeReason = reason
+			mu.Unlock()
+			record(item, "close")
+		},
+	})
+
+	item := mustGet(t, pool)
+	item.Close()
+	item = mustGet(t, pool)
+	item.SetErr(errUse)
+	item.Close()
+	item = mustGet(t, pool)
+	item.Close()
+	pool.Close()
+	waitFor(t, item.Closed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[int]string{
+		1: "[create borrow 1 return borrow 2 discard true]",
+		2: "[create borrow 1 return close discard false]",
+	}
+	for id, w := range want {
+		if got := fmt.Sprint(events[id]); got != w {
+			t.Fatalf("events of item %v: %v, want %v", id, got, w)
+		}
+	}
+	var poolErr *connpool.PoolError
+	if !errors.As(closeReason, &poolErr) || !errors.Is(closeReason, connpool.ErrPoolClosed) {
+		t.Fatalf("OnClose reason %v", closeReason)
+	}
+	if poolErr.Op != "close" || poolErr.ItemID != 2 {
+		t.Fatalf("OnClose reason %+v", poolErr)
+	}
+}
+
+func TestCloseWakesWaiters(t *testing.T) {
+	pool, _ := newTestPool(t, 1, 1)
+	item := mustGet(t, pool)
+	errc := make(chan error)
+	go func() {
+		_, err := pool.Get()
+		errc <- err
+	}()
+	waitFor(t, func() bool { return pool.Stats().WaiterNum == 1 })
+	pool.Close()
+	if err := <-errc; !errors.Is(err, connpool.ErrPoolClosed) {
+		t.Fatalf("waiting Get: %v", err)
+	}
+	item.Close()
+	connpooltest.WaitForTotal(t, pool, 0)
+}
+
+// Resume() serving a waiting Get() makes room in idle items for a waiting
+// GiveBackSync() without deadlock.
+func TestResumeWithRoomWaiter(t *testing.T) {
+	pool, _ := newTestPool(t, 2, 1)
+	pool.SetPauseWait(true)
+	a := mustGet(t, pool)
+	b := mustGet(t, pool)
+	pool.Pause("test", false)
+	if err := pool.GiveBackSync(a); err != nil {
+		t.Fatalf("GiveBackSync: %v", err)
+	}
+	go pool.Get()
+	go pool.GiveBackSync(b)
+	waitFor(t, func() bool {
+		s := pool.Stats()
+		return s.WaiterNum == 1 && s.IdleFullNum == 1
+	})
+	done := make(chan struct{})
+	go func() {
+		pool.Resume()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(connpooltest.WaitTimeout):
+		t.Fatal("Resume deadlocked")
+	}
+}
+
+func TestInitItemFailure(t *testing.T) {
+	pool, creator := newTestPool(t, 2, 2)
+	creator.FailInitItem(errInit)
+	item := mustGet(t, pool)
+	first := creator.Items()[0]
+	if item == first {
+		t.Fatal("got the item failing InitItem")
+	}
+	waitFor(t, first.Closed)
+	if calls := first.SetErrCalls(); len(calls) != 1 || !errors.Is(calls[0], errInit) {
+		t.Fatalf("item failing InitItem got SetErr %v", calls)
+	}
+	if s := pool.Stats(); s.InitFailedNum != 1 {
+		t.Fatalf("InitFailedNum %v, want 1", s.InitFailedNum)
+	}
+	item.Close()
+	connpooltest.AssertNoLeaks(t, pool)
+}
+
+func TestNewItemFailureRetry(t *testing.T) {
+	pool, creator := newTestPool(t, 1, 1)
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	creator.FailNewItem(errDial)
+	done := make(chan connpool.PoolItem)
+	go func() {
+		item, err := pool.Get()
+		if err != nil {
+			t.Errorf("Get: %v", err)
+		}
+		done <- item
+	}()
+	// the retry of creation is scheduled 2 seconds later
+	clock.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("Get returned before the retry")
+	default:
+	}
+	clock.Advance(2 * time.Second)
+	item := <-done
+	if n := creator.NewItemNum(); n != 2 {
+		t.Fatalf("NewItem called %v times, want 2", n)
+	}
+	if s := pool.Stats(); s.CreateFailedNum != 1 || s.CreatedNum != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+	item.Close()
+	connpooltest.AssertNoLeaks(t, pool)
+}
+
+func TestGetTimeout(t *testing.T) {
+	pool, _ := newTestPool(t, 1, 1)
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	pool.SetGetTimeout(3)
+	item := mustGet(t, pool)
+	errc := make(chan error)
+	go func() {
+		_, err := pool.Get()
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(3 * time.Second)
+	if err := <-errc; !errors.Is(err, connpool.ErrGetTimeout) {
+		t.Fatalf("Get: %v", err)
+	}
+	item.Close()
+	connpooltest.AssertNoLeaks(t, pool)
+}
+
+func TestResetItem(t *testing.T) {
+	errReset := errors.New("dirty")
+	for _, sharded := range []bool{false, true} {
+		creator := connpooltest.NewFakeCreator()
+		var pool *connpool.Pool
+		if sharded {
+			pool = connpool.NewShardedPool(t.Name(), creator, 2, 2, 0, 2)
+		} else {
+			pool = connpool.NewPool(t.Name(), creator, 2, 2, 0)
+		}
+		creator.SetPool(pool, true)
+		item := mustGet(t, pool)
+		item.Close()
+		creator.FailResetItem(errReset)
+		item = mustGet(t, pool)
+		if err := pool.GiveBackSync(item); !errors.Is(err, errReset) {
+			t.Fatalf("GiveBackSync: %v", err)
+		}
+		waitFor(t, item.Closed)
+		if calls := item.SetErrCalls(); len(calls) != 1 || !errors.Is(calls[0], errReset) {
+			t.Fatalf("item failing ResetItem got SetErr %v", calls)
+		}
+		if n := creator.ResetItemNum(); n != 2 {
+			t.Fatalf("ResetItem called %v times, want 2", n)
+		}
+		if s := pool.Stats(); s.ResetFailedNum != 1 {
+			t.Fatalf("ResetFailedNum %v, want 1", s.ResetFailedNum)
+		}
+		connpooltest.AssertNoLeaks(t, pool)
+		pool.Close()
+	}
+}
+
+// Items closed instead of being reused are not reset, so that a failure of
+// ResetItem() does not hide the reason.
+func TestResetItemSkipped(t *testing.T) {
+	errReset := errors.New("dirty")
+	for _, sharded := range []bool{false, true} {
+		for _, want := range []error{connpool.ErrPoolClosed, connpool.ErrMaxUses} {
+			creator := connpooltest.NewFakeCreator()
+			var pool *connpool.Pool
+			if sharded {
+				pool = connpool.NewShardedPool(t.Name(), creator, 2, 2, 0, 2)
+			} else {
+				pool = connpool.NewPool(t.Name(), creator, 2, 2, 0)
+			}
+			creator.SetPool(pool, true)
+			creator.FailResetItem(errReset)
+			item := mustGet(t, pool)
+			if want == connpool.ErrPoolClosed {
+				pool.Close()
+			} else {
+				pool.SetMaxUses(1)
+			}
+			if err := pool.GiveBackSync(item); !errors.Is(err, want) {
+				t.Fatalf("GiveBackSync: %v, want %v", err, want)
+			}
+			if n := creator.ResetItemNum(); n != 0 {
+				t.Fatalf("ResetItem called %v times on an item closed with %v", n, want)
+			}
+			if s := pool.Stats(); s.ResetFailedNum != 0 {
+				t.Fatalf("ResetFailedNum %v, want 0", s.ResetFailedNum)
+			}
+			pool.Close()
+		}
+	}
+}
+
+// The timeout of a Get() is kept when it retries after Creator.InitItem()
+// fails.
+func TestGetTimeoutAfterInitRetry(t *testing.T) {
+	pool, creator := newTestPool(t, 1, 1)
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	pool.SetGetTimeout(10)
+	item := mustGet(t, pool)
+	errc := make(chan error)
+	go func() {
+		_, err := pool.Get()
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	creator.FailInitItem(errInit)
+	creator.FailNewItem(errDial, errDial, errDial)
+	clock.Advance(10 * time.Second)
+	// the waiting Get() gets the item, which fails InitItem() after the timeout
+	item.Close()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, connpool.ErrGetTimeout) {
+			t.Fatalf("Get: %v", err)
+		}
+	case <-time.After(connpooltest.WaitTimeout):
+		t.Fatal("Get ignored its timeout")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	creator := connpooltest.NewFakeCreator()
+	pool := connpool.NewPool(t.Name(), creator, 2, 2, 5)
+	creator.SetPool(pool, true)
+	defer pool.Close()
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	item := mustGet(t, pool)
+	item.Close()
+	clock.Advance(6 * time.Second)
+	if again := mustGet(t, pool); again == item {
+		t.Fatal("got an idle timeout item")
+	}
+	waitFor(t, item.Closed)
+	if s := pool.Stats(); s.IdleTimeoutClosedNum == 0 {
+		t.Fatal("IdleTimeoutClosedNum not counted")
+	}
+}
+
+// Checks limited by SetEvictScanNum() continue from where the last one stopped,
+// so that expired items behind fresh ones are closed too.
+func TestEvictScanNum(t *testing.T) {
+	creator := connpooltest.NewFakeCreator()
+	pool := connpool.NewShardedPool(t.Name(), creator, 16, 16, 100, 2)
+	creator.SetPool(pool, true)
+	defer pool.Close()
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	pool.SetEvictInterval(time.Second)
+	pool.SetEvictScanNum(1)
+
+	items := make([]*connpooltest.FakeItem, 16)
+	for i := range items {
+		items[i] = mustGet(t, pool)
+	}
+	// each shard gets old items followed by fresh ones
+	for _, item := range items[:8] {
+		item.Close()
+	}
+	clock.BlockUntil(1)
+	clock.Advance(60 * time.Second)
+	for _, item := range items[8:] {
+		item.Close()
+	}
+	clock.BlockUntil(1)
+	clock.Advance(40 * time.Second)
+	for i := 0; i < 30 && pool.GetIdleNum() > 8; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+	}
+	if n := pool.GetIdleNum(); n != 8 {
+		t.Fatalf("%v items idle, want 8", n)
+	}
+	for _, item := range items[:8] {
+		waitFor(t, item.Closed)
+	}
+}
+
+// Items are neither leaked nor over-allocated by concurrent users, some of
+// which break their items.
+func TestNoLeaks(t *testing.T) {
+	for _, sharded := range []bool{false, true} {
+		creator := connpooltest.NewFakeCreator()
+		var pool *connpool.Pool
+		if sharded {
+			pool = connpool.NewShardedPool(t.Name(), creator, 8, 4, 0, 4)
+		} else {
+			pool = connpool.NewPool(t.Name(), creator, 8, 4, 0)
+		}
+		creator.SetPool(pool, false)
+		pool.SetIdleFullPolicy(connpool.IdleFullClose, 0)
+		var wg sync.WaitGroup
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					item, err := pool.Get()
+					if err != nil {
+						t.Errorf("Get: %v", err)
+						return
+					}
+					if n := pool.GetTotalNum(); n > 8 {
+						t.Errorf("total %v beyond max", n)
+					}
+					if rand.IntN(10) == 0 {
+						item.SetErr(errUse)
+					}
+					item.Close()
+				}
+			}()
+		}
+		wg.Wait()
+		connpooltest.AssertNoLeaks(t, pool)
+		pool.Close()
+		connpooltest.WaitForTotal(t, pool, 0)
+	}
+}
+
+func TestMaxUses(t *testing.T) {
+	pool, creator := newTestPool(t, 1, 1)
+	pool.SetMaxUses(2)
+	item := mustGet(t, pool)
+	item.Close()
+	if again := mustGet(t, pool); again != item {
+		t.Fatalf("got item %v, want the idle item %v", again.ID(), item.ID())
+	}
+	if err := item.Close(); !errors.Is(err, connpool.ErrMaxUses) {
+		t.Fatalf("Close after max uses: %v", err)
+	}
+	waitFor(t, item.Closed)
+	if !errors.Is(item.GetErr(), connpool.ErrMaxUses) {
+		t.Fatalf("item used up not closed with ErrMaxUses: %v", item.GetErr())
+	}
+
+	// a replacement is created for the item used up
+	connpooltest.WaitForIdle(t, pool, 1)
+	replacement := mustGet(t, pool)
+	if replacement == item || creator.NewItemNum() != 2 {
+		t.Fatalf("got item %v, want a replacement", replacement.ID())
+	}
+	if info, _ := pool.ItemInfo(replacement); info.UseCount != 1 {
+		t.Fatalf("replacement used %v times", info.UseCount)
+	}
+	replacement.Close()
+
+	// lowering the limit closes the idle item used up on Get()
+	pool.SetMaxUses(1)
+	if again := mustGet(t, pool); again == replacement {
+		t.Fatal("got the idle item beyond max uses")
+	} else {
+		again.Close()
+	}
+	waitFor(t, replacement.Closed)
+	// the last item got is used up too
+	if n := pool.Stats().MaxUsesClosedNum; n != 3 {
+		t.Fatalf("MaxUsesClosedNum %v, want 3", n)
+	}
+}
+
+// Items closed by Get() without being returned report the uses they had.
+func TestUseCount(t *testing.T) {
+	pool, creator := newTestPool(t, 1, 1)
+	useCounts := make(chan uint64, 3)
+	pool.SetHooks(connpool.Hooks{
+		OnClose: func(item connpool.PoolItem, reason error) {
+			info, _ := pool.ItemInfo(item)
+			useCounts <- info.UseCount
+		},
+	})
+	item := mustGet(t, pool)
+	item.Close()
+	mustGet(t, pool).Close()
+	pool.SetMaxUses(2)
+	item = mustGet(t, pool)
+	if n := <-useCounts; n != 2 {
+		t.Fatalf("item beyond max uses reports UseCount %v, want 2", n)
+	}
+	item.Close()
+
+	// nor is a failed InitItem() counted
+	creator.FailInitItem(errInit)
+	item = mustGet(t, pool)
+	if n := <-useCounts; n != 1 {
+		t.Fatalf("item failing InitItem reports UseCount %v, want 1", n)
+	}
+	if info, _ := pool.ItemInfo(item); info.UseCount != 1 {
+		t.Fatalf("UseCount %v of the replacement, want 1", info.UseCount)
+	}
+}
+
+// Get 3 items of a pool with room for 1 idle item, and give back the first.
+func newIdleFullPool(t *testing.T, policy connpool.IdleFullPolicy, wait time.Duration) (*connpool.Pool, []*connpooltest.FakeItem) {
+	t.Helper()
+	pool, _ := newTestPool(t, 3, 1)
+	pool.SetIdleFullPolicy(policy, wait)
+	items := []*connpooltest.FakeItem{mustGet(t, pool), mustGet(t, pool), mustGet(t, pool)}
+	if err := pool.GiveBackSync(items[0]); err != nil {
+		t.Fatalf("GiveBackSync: %v", err)
+	}
+	return pool, items
+}
+
+func TestIdleFullClose(t *testing.T) {
+	pool, items := newIdleFullPool(t, connpool.IdleFullClose, time.Hour)
+	if err := pool.GiveBackSync(items[1]); !errors.Is(err, connpool.ErrIdleFull) {
+		t.Fatalf("GiveBackSync with idle items full: %v", err)
+	}
+	waitFor(t, items[1].Closed)
+	if items[0].Closed() || pool.GetIdleNum() != 1 {
+		t.Fatal("idle item closed")
+	}
+	if stats := pool.Stats(); stats.IdleFullNum != 1 || stats.IdleFullClosedNum != 1 ||
+		stats.IdleFullEvictedNum != 0 || stats.IdleFullWaitedNum != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestIdleFullEvictOldest(t *testing.T) {
+	pool, items := newIdleFullPool(t, connpool.IdleFullEvictOldest, 0)
+	if err := pool.GiveBackSync(items[1]); err != nil {
+		t.Fatalf("GiveBackSync with idle items full: %v", err)
+	}
+	waitFor(t, items[0].Closed)
+	if err := items[0].GetErr(); !errors.Is(err, connpool.ErrIdleFull) {
+		t.Fatalf("oldest idle item closed with %v", err)
+	}
+	if again := mustGet(t, pool); again != items[1] {
+		t.Fatalf("got item %v, want the item given back %v", again.ID(), items[1].ID())
+	}
+	if stats := pool.Stats(); stats.IdleFullNum != 1 || stats.IdleFullEvictedNum != 1 ||
+		stats.IdleFullClosedNum != 0 || stats.IdleFullWaitedNum != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestIdleFullWait(t *testing.T) {
+	pool, items := newIdleFullPool(t, connpool.IdleFullWait, time.Second)
+	clock := connpooltest.NewFakeClock(time.Now())
+	pool.SetClock(clock)
+	errc := make(chan error, 1)
+	giveBack := func(item connpool.PoolItem) {
+		errc <- pool.GiveBackSync(item)
+	}
+
+	// room made by Get() is taken by the waiting item
+	go giveBack(items[1])
+	clock.BlockUntil(1)
+	if again := mustGet(t, pool); again != items[0] {
+		t.Fatalf("got item %v, want the idle item %v", again.ID(), items[0].ID())
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("GiveBackSync after waiting for room: %v", err)
+	}
+
+	// the waiting item is closed on timeout
+	go giveBack(items[2])
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if err := <-errc; !errors.Is(err, connpool.ErrIdleFull) {
+		t.Fatalf("GiveBackSync after waiting in vain: %v", err)
+	}
+	if stats := pool.Stats(); stats.IdleFullNum != 2 || stats.IdleFullWaitedNum != 1 ||
+		stats.IdleFullClosedNum != 1 || stats.IdleFullEvictedNum != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
@@ -0,0 +1,76 @@
+package connpool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrDuplicateName = errors.New("pool name already registered")
+
+// Process-wide registry of pools by name, see Pool.Register().
+var registry = struct {
+	sync.Mutex
+	pools map[string]*Pool
+}{
+	pools: make(map[string]*Pool),
+}
+
+// Register the pool by its name in the process-wide registry, so that it can
+// be found by LookupPool() and Pools() for metrics, debugging and shutdown.
+// Registration is optional, and the pool is unregistered when closed.
+//
+// It returns ErrDuplicateName if another pool of the same name is registered,
+// or ErrPoolClosed if the pool is closed.
+func (self *Pool) Register() error {
+	registry.Lock()
+	defer registry.Unlock()
+	if self.Closed() {
+		return self.wrapErr("register", nil, ErrPoolClosed)
+	}
+	if pool, ok := registry.pools[self.name]; ok {
+		if pool == self {
+			return nil
+		}
+		return self.wrapErr("register", nil, ErrDuplicateName)
+	}
+	registry.pools[self.name] = self
+	return nil
+}
+
+// Remove the pool from the registry if it is registered.
+func (self *Pool) Unregister() {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.pools[self.name] == self {
+		delete(registry.pools, self.name)
+	}
+}
+
+// Get the registered pool of the given name, or nil.
+func LookupPool(name string) *Pool {
+	registry.Lock()
+	defer registry.Unlock()
+	return registry.pools[name]
+}
+
+// Get all registered pools in order of name.
+func Pools() []*Pool {
+	registry.Lock()
+	pools := make([]*Pool, 0, len(registry.pools))
+	for _, pool := range registry.pools {
+		pools = append(pools, pool)
+	}
+	registry.Unlock()
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].name < pools[j].name
+	})
+	return pools
+}
+
+// Close all registered pools, e.g., on process shutdown.
+func CloseAll() {
+	for _, pool := range Pools() {
+		pool.Close()
+	}
+}
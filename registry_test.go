@@ -0,0 +1,90 @@
+package connpool_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+func TestRegister(t *testing.T) {
+	a := connpool.NewPool(t.Name(), connpooltest.NewFakeCreator(), 1, 1, 0)
+	b := connpool.NewPool(t.Name(), connpooltest.NewFakeCreator(), 1, 1, 0)
+	defer b.Close()
+	if err := a.Register(); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := a.Register(); err != nil {
+		t.Fatalf("Register again: %v", err)
+	}
+	err := b.Register()
+	var poolErr *connpool.PoolError
+	if !errors.Is(err, connpool.ErrDuplicateName) || !errors.As(err, &poolErr) || poolErr.Op != "register" {
+		t.Fatalf("Register of a duplicate name: %v", err)
+	}
+	if pool := connpool.LookupPool(t.Name()); pool != a {
+		t.Fatalf("LookupPool: %v", pool)
+	}
+	if !slices.Contains(connpool.Pools(), a) || slices.Contains(connpool.Pools(), b) {
+		t.Fatal("Pools() not the registered ones")
+	}
+
+	// unregistering another pool of the name is a no-op
+	b.Unregister()
+	if pool := connpool.LookupPool(t.Name()); pool != a {
+		t.Fatalf("LookupPool after Unregister of another pool: %v", pool)
+	}
+	a.Close()
+	if pool := connpool.LookupPool(t.Name()); pool != nil {
+		t.Fatalf("closed pool still registered: %v", pool)
+	}
+	if err := a.Register(); !errors.Is(err, connpool.ErrPoolClosed) {
+		t.Fatalf("Register of a closed pool: %v", err)
+	}
+	if err := b.Register(); err != nil {
+		t.Fatalf("Register after the pool of the name is closed: %v", err)
+	}
+	b.Unregister()
+	if pool := connpool.LookupPool(t.Name()); pool != nil {
+		t.Fatalf("LookupPool after Unregister: %v", pool)
+	}
+}
+
+func TestPoolsOrder(t *testing.T) {
+	for _, name := range []string{"c", "a", "b"} {
+		pool := connpool.NewPool(t.Name()+"-"+name, connpooltest.NewFakeCreator(), 1, 1, 0)
+		defer pool.Close()
+		pool.Register()
+	}
+	var names []string
+	for _, pool := range connpool.Pools() {
+		names = append(names, pool.GetName())
+	}
+	if !slices.IsSorted(names) || len(names) < 3 {
+		t.Fatalf("Pools() in order %v", names)
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	pools := make([]*connpool.Pool, 3)
+	for i := range pools {
+		pools[i] = connpool.NewPool(t.Name()+string(rune('a'+i)), connpooltest.NewFakeCreator(), 1, 1, 0)
+		pools[i].Register()
+	}
+	unregistered := connpool.NewPool(t.Name(), connpooltest.NewFakeCreator(), 1, 1, 0)
+	defer unregistered.Close()
+	connpool.CloseAll()
+	for _, pool := range pools {
+		if !pool.Closed() {
+			t.Fatalf("pool %v not closed", pool.GetName())
+		}
+	}
+	if unregistered.Closed() {
+		t.Fatal("unregistered pool closed")
+	}
+	if pools := connpool.Pools(); len(pools) != 0 {
+		t.Fatalf("pools registered after CloseAll: %v", len(pools))
+	}
+}
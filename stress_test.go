@@ -0,0 +1,102 @@
+package connpool_test
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marlonche/connpool"
+	"github.com/marlonche/connpool/connpooltest"
+)
+
+// Run with -race. Users keep getting and returning items, some of them
+// broken, while the pool is paused, resumed, invalidated and has items
+// evicted, and finally closed under load.
+func TestStress(t *testing.T) {
+	for _, sharded := range []bool{false, true} {
+		for _, syncReturn := range []bool{false, true} {
+			stress(t, sharded, syncReturn)
+		}
+	}
+}
+
+func stress(t *testing.T, sharded bool, syncReturn bool) {
+	const maxTotal = 8
+	creator := connpooltest.NewFakeCreator()
+	var pool *connpool.Pool
+	if sharded {
+		pool = connpool.NewShardedPool(t.Name(), creator, maxTotal, 2, 0, 4)
+	} else {
+		pool = connpool.NewPool(t.Name(), creator, maxTotal, 2, 0)
+	}
+	creator.SetPool(pool, syncReturn)
+	pool.SetGetTimeout(1)
+	// GiveBack() often finds idle items full and waits for room
+	pool.SetIdleFullPolicy(connpool.IdleFullWait, 5*time.Millisecond)
+
+	var gets atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, err := pool.Get()
+				switch {
+				case errors.Is(err, connpool.ErrPoolClosed):
+					return
+				case errors.Is(err, connpool.ErrPoolPaused), errors.Is(err, connpool.ErrGetTimeout):
+					time.Sleep(time.Millisecond)
+					continue
+				case err != nil:
+					t.Errorf("Get: %v", err)
+					return
+				}
+				gets.Add(1)
+				if n := pool.GetTotalNum(); n > maxTotal {
+					t.Errorf("total %v beyond max", n)
+				}
+				if rand.IntN(20) == 0 {
+					item.SetErr(errors.New("broken while used"))
+				}
+				item.Close()
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		switch rand.IntN(6) {
+		case 0:
+			pool.Pause("stress", rand.IntN(2) == 0)
+		case 1:
+			pool.Resume()
+		case 2:
+			pool.SetPauseWait(rand.IntN(2) == 0)
+		case 3:
+			pool.Invalidate()
+		default:
+			if items := creator.Items(); len(items) > 0 {
+				pool.Evict(items[rand.IntN(len(items))], nil)
+			}
+		}
+		time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+	}
+	if rand.IntN(2) == 0 {
+		pool.Resume()
+	}
+	pool.Close()
+	wg.Wait()
+
+	if gets.Load() == 0 {
+		t.Error("no item is got")
+	}
+	connpooltest.WaitForTotal(t, pool, 0)
+	for _, item := range creator.Items() {
+		if !item.Closed() {
+			t.Fatalf("item %v not closed", item.ID())
+		}
+	}
+}